@@ -1,21 +1,46 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"github.com/KylerJacobson/Go-Blog-API/internal/middleware"
+	"github.com/KylerJacobson/Go-Blog-API/internal/password"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
 	"github.com/KylerJacobson/Go-Blog-API/internal/services/azure"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/local"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/mailer"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/markdown"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/reconciler"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/s3"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/scheduler"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
 	"github.com/KylerJacobson/Go-Blog-API/internal/db/config"
 
+	commentsRepo "github.com/KylerJacobson/Go-Blog-API/internal/db/comments"
 	mediaRepo "github.com/KylerJacobson/Go-Blog-API/internal/db/media"
 	postsRepo "github.com/KylerJacobson/Go-Blog-API/internal/db/posts"
+	rolesRepo "github.com/KylerJacobson/Go-Blog-API/internal/db/roles"
+	tagsRepo "github.com/KylerJacobson/Go-Blog-API/internal/db/tags"
+	uploadsRepo "github.com/KylerJacobson/Go-Blog-API/internal/db/uploads"
 	usersRepo "github.com/KylerJacobson/Go-Blog-API/internal/db/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/comments"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/feeds"
 	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/media"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/passwordreset"
 	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/posts"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/roles"
 	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/tags"
 	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/users"
 	"github.com/KylerJacobson/Go-Blog-API/logger"
 )
@@ -30,36 +55,105 @@ func main() {
 	dbPool := config.GetDBConn(zapLogger)
 	defer dbPool.Close()
 
-	azureClient := azure.NewAzureClient(zapLogger)
-
 	session.Init()
+	authorization.SetSessionLookup(usersRepo.New(dbPool, zapLogger).GetSessionState)
+
+	rolesApi := roles.New(rolesRepo.New(dbPool, zapLogger), zapLogger)
+	if err := rolesApi.Reload(); err != nil {
+		zapLogger.Sugar().Errorf("error loading custom roles, only the built-in roles apply: %v", err)
+	}
 
 	mux := http.NewServeMux()
-	usersApi := users.New(usersRepo.New(dbPool, zapLogger), zapLogger)
-	postsApi := posts.New(postsRepo.New(dbPool, zapLogger), zapLogger)
+	blobStore := newBlobStore(zapLogger, mux)
+	siteURL := getEnv("SITE_URL", "https://kylerjacobson.dev")
+	mail := newMailer(zapLogger)
+	passwordPolicy := parsePasswordPolicy("PASSWORD_MIN_LENGTH", "PASSWORD_REQUIRE")
+	usersApi := users.New(usersRepo.New(dbPool, zapLogger), zapLogger, mail, users.Config{
+		VerifyURL:       getEnv("EMAIL_VERIFY_URL", siteURL+"/api/user/verify"),
+		VerificationTTL: parseDuration("EMAIL_VERIFY_TTL", "48h"),
+		PasswordPolicy:  passwordPolicy,
+	})
+	postsRepository := postsRepo.New(dbPool, zapLogger)
+	renderer := markdown.NewRenderer(1024)
+	postsApi := posts.New(postsRepository, zapLogger, renderer)
+	feedsApi := feeds.New(postsRepository, zapLogger, renderer, feeds.Config{
+		SiteURL:     siteURL,
+		Title:       getEnv("SITE_TITLE", "Kyler Jacobson"),
+		Description: os.Getenv("SITE_DESCRIPTION"),
+	})
+	commentsApi := comments.New(commentsRepo.New(dbPool, zapLogger), postsRepository, zapLogger)
+	tagsApi := tags.New(tagsRepo.New(dbPool, zapLogger), zapLogger)
 
 	sessionApi := session.New(usersRepo.New(dbPool, zapLogger), zapLogger)
-	mediaApi := media.New(mediaRepo.New(dbPool, zapLogger), zapLogger, azureClient)
+	passwordResetApi := passwordreset.New(usersRepo.New(dbPool, zapLogger), mail, zapLogger, passwordreset.Config{
+		ResetURL:       getEnv("PASSWORD_RESET_URL", siteURL+"/reset-password"),
+		TokenTTL:       parseDuration("PASSWORD_RESET_TTL", "30m"),
+		PasswordPolicy: passwordPolicy,
+	})
+	mediaRepository := mediaRepo.New(dbPool, zapLogger)
+	mediaApi := media.New(mediaRepository, postsRepository, zapLogger, blobStore, media.Config{
+		VariantWidths:    parseWidths(getEnv("MEDIA_VARIANT_WIDTHS", "320,640,1280")),
+		URLTTL:           parseDuration("MEDIA_URL_TTL", "1h"),
+		RestrictedURLTTL: parseDuration("MEDIA_RESTRICTED_URL_TTL", "5m"),
+		UploadPolicy:     parseUploadPolicy("MEDIA_UPLOAD_POLICY"),
+	})
+	uploadsRepository := uploadsRepo.New(dbPool, zapLogger)
+	uploadsApi := media.NewUploads(uploadsRepository, mediaApi, zapLogger, parseSize("MEDIA_MAX_UPLOAD_SIZE", 2<<30))
 
 	// ---------------------------- Posts ----------------------------
 	mux.HandleFunc("GET /api/posts", postsApi.GetPosts)
 	mux.HandleFunc("GET /api/posts/recent", postsApi.GetRecentPosts)
+	mux.HandleFunc("GET /api/posts/search", postsApi.SearchPosts)
 	mux.HandleFunc("GET /api/posts/{id}", postsApi.GetPostById)
 	mux.HandleFunc("DELETE /api/posts/{id}", postsApi.DeletePostById)
-	mux.HandleFunc("POST /api/posts", postsApi.CreatePost)
+	mux.HandleFunc("POST /api/posts", middleware.RequirePermission(rbac.PostCreate)(postsApi.CreatePost))
 	mux.HandleFunc("PUT /api/posts/{id}", postsApi.UpdatePost)
+	mux.HandleFunc("GET /api/posts/{id}/revisions", postsApi.ListRevisions)
+	mux.HandleFunc("GET /api/posts/{id}/revisions/diff", postsApi.DiffRevisions)
+	mux.HandleFunc("POST /api/posts/{id}/revisions/{rev}/restore", postsApi.RestoreRevision)
+	// Slug lookups live outside /api/posts/{id}/..., where a slug pattern would
+	// collide with the post's sub-resources.
+	mux.HandleFunc("GET /api/p/{slug}", postsApi.GetPostBySlug)
+
+	// ---------------------------- Comments ----------------------------
+	mux.HandleFunc("GET /api/posts/{id}/comments", commentsApi.ListComments)
+	mux.HandleFunc("POST /api/posts/{id}/comments", commentsApi.CreateComment)
+
+	// ---------------------------- Feeds ----------------------------
+	mux.HandleFunc("GET /feed.rss", feedsApi.GetRSSFeed)
+	mux.HandleFunc("GET /feed.atom", feedsApi.GetAtomFeed)
+	mux.HandleFunc("GET /feed.json", feedsApi.GetJSONFeed)
+
+	// ---------------------------- Tags ----------------------------
+	mux.HandleFunc("GET /api/tags", tagsApi.GetTags)
 
 	// ---------------------------- Users ----------------------------
 	mux.HandleFunc("POST /api/user", usersApi.CreateUser)
 	mux.HandleFunc("GET /api/user", usersApi.GetUserFromSession)
+	mux.HandleFunc("GET /api/user/verify", usersApi.VerifyEmail)
 	mux.HandleFunc("GET /api/user/{id}", usersApi.GetUserById)
 	mux.HandleFunc("PUT /api/user/{id}", usersApi.UpdateUser)
 	mux.HandleFunc("DELETE /api/user/{id}", usersApi.DeleteUserById)
+	mux.HandleFunc("PUT /api/user/{id}/password", usersApi.ChangePassword)
+	mux.HandleFunc("POST /api/password-reset", passwordResetApi.RequestReset)
+	mux.HandleFunc("POST /api/password-reset/confirm", passwordResetApi.ConfirmReset)
 
 	// TODO Create admin route with authorization and update user list
 
 	// ---------------------------- Admin ----------------------------
-	mux.HandleFunc("GET /api/user/list", http.HandlerFunc(middleware.AuthAdminMiddleware(usersApi.ListUsers)))
+	mux.HandleFunc("GET /api/user/list", middleware.RequirePermission(rbac.UserManage)(usersApi.ListUsers))
+	mux.HandleFunc("POST /api/user/{id}/verify", middleware.RequirePermission(rbac.UserManage)(usersApi.ForceVerify))
+	mux.HandleFunc("POST /api/user/{id}/verify/resend", middleware.RequirePermission(rbac.UserManage)(usersApi.ResendVerification))
+	mux.HandleFunc("POST /api/user/{id}/password/force-reset", middleware.RequirePermission(rbac.UserManage)(usersApi.ForcePasswordReset))
+	mux.HandleFunc("GET /api/access-requests", middleware.RequirePermission(rbac.UserAssignRole)(usersApi.ListAccessRequests))
+	mux.HandleFunc("POST /api/access-requests/{id}/approve", middleware.RequirePermission(rbac.UserAssignRole)(usersApi.ApproveAccessRequest))
+	mux.HandleFunc("POST /api/access-requests/{id}/deny", middleware.RequirePermission(rbac.UserAssignRole)(usersApi.DenyAccessRequest))
+	mux.HandleFunc("GET /api/comments/pending", middleware.RequirePermission(rbac.CommentModerate)(commentsApi.ListPendingComments))
+	mux.HandleFunc("PUT /api/comments/{id}/moderation", middleware.RequirePermission(rbac.CommentModerate)(commentsApi.ModerateComment))
+	mux.HandleFunc("GET /api/media", middleware.RequirePermission(rbac.MediaManage)(mediaApi.ListMedia))
+	mux.HandleFunc("GET /api/roles", middleware.RequirePermission(rbac.RoleManage)(rolesApi.ListRoles))
+	mux.HandleFunc("PUT /api/roles/{id}", middleware.RequirePermission(rbac.RoleManage)(rolesApi.SaveRole))
+	mux.HandleFunc("DELETE /api/roles/{id}", middleware.RequirePermission(rbac.RoleManage)(rolesApi.DeleteRole))
 
 	// ---------------------------- Session ----------------------------
 
@@ -68,11 +162,181 @@ func main() {
 	mux.HandleFunc("DELETE /api/session", sessionApi.DeleteSession)
 
 	// ---------------------------- Media ----------------------------
-	mux.HandleFunc("POST /api/media", mediaApi.UploadMedia)
+	mux.HandleFunc("POST /api/media", middleware.RequirePermission(rbac.MediaUpload)(mediaApi.UploadMedia))
 	mux.HandleFunc("GET /api/media/{id}", mediaApi.GetMediaByPostId)
+	mux.HandleFunc("GET /api/media/{id}/content", mediaApi.GetMediaContent)
+	mux.HandleFunc("DELETE /api/media/{mediaId}", mediaApi.DeleteMedia)
+
+	// ---------------------------- Uploads (tus) ----------------------------
+	mux.HandleFunc("OPTIONS /api/uploads", uploadsApi.Options)
+	mux.HandleFunc("POST /api/uploads", middleware.RequirePermission(rbac.MediaUpload)(uploadsApi.CreateUpload))
+	mux.HandleFunc("HEAD /api/uploads/{id}", uploadsApi.GetUploadOffset)
+	mux.HandleFunc("PATCH /api/uploads/{id}", uploadsApi.PatchUpload)
+	mux.HandleFunc("DELETE /api/uploads/{id}", uploadsApi.DeleteUpload)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go scheduler.NewPublisher(postsRepository, zapLogger, time.Minute).Run(ctx)
+	go reconciler.NewReconciler(mediaRepository, uploadsRepository, blobStore, zapLogger, time.Hour, 24*time.Hour).Run(ctx)
 
 	zapLogger.Sugar().Infof("Logging level set to %s", env)
 	zapLogger.Sugar().Infof("listening on port: %d", 8080)
-	http.ListenAndServe(":8080", session.Manager.LoadAndSave(mux))
-	// log.Fatal(http.ListenAndServe(":8080", nil))
+	server := &http.Server{Addr: ":8080", Handler: session.Manager.LoadAndSave(authorization.CacheClaims(mux))}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM, finish the requests in flight and the password
+	// reset emails they started before exiting.
+	<-ctx.Done()
+	zapLogger.Sugar().Infof("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		zapLogger.Sugar().Errorf("error shutting down the server: %v", err)
+	}
+	if err := passwordResetApi.Shutdown(shutdownCtx); err != nil {
+		zapLogger.Sugar().Errorf("error waiting for password reset emails: %v", err)
+	}
+}
+
+// newBlobStore picks the media storage backend from MEDIA_BACKEND. The local
+// backend serves its own signed URLs, so it also registers a route on mux.
+func newBlobStore(zapLogger logger.Logger, mux *http.ServeMux) storage.BlobStore {
+	switch backend := getEnv("MEDIA_BACKEND", "azure"); backend {
+	case "azure":
+		store, err := azure.NewAzureClient(zapLogger)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return storage.NewCachedURLs(store)
+	case "local":
+		signingKey := os.Getenv("MEDIA_SIGNING_KEY")
+		if signingKey == "" {
+			log.Fatal("MEDIA_SIGNING_KEY must be set when MEDIA_BACKEND is local")
+		}
+		store, err := local.NewLocalStore(
+			getEnv("MEDIA_LOCAL_DIR", "./media"),
+			getEnv("MEDIA_BASE_URL", "http://localhost:8080"),
+			[]byte(signingKey),
+			zapLogger,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		mux.Handle("GET /media/{name...}", store)
+		return storage.NewCachedURLs(store)
+	case "s3":
+		store, err := s3.NewS3Client(s3.Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    getEnv("S3_BUCKET", "media"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			UseSSL:    getEnv("S3_USE_SSL", "true") != "false",
+			URLTTL:    parseDuration("S3_URL_TTL", "168h"),
+		}, zapLogger)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return storage.NewCachedURLs(store)
+	default:
+		log.Fatalf("unknown MEDIA_BACKEND %q", backend)
+		return nil
+	}
+}
+
+// newMailer sends mail through SMTP_HOST when it is set, and only logs it
+// otherwise.
+func newMailer(zapLogger logger.Logger) mailer.Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		zapLogger.Sugar().Infof("SMTP_HOST is not set, emails will be logged instead of sent")
+		return mailer.NewLogMailer(zapLogger)
+	}
+	return mailer.NewSMTPMailer(
+		host,
+		getEnv("SMTP_PORT", "587"),
+		os.Getenv("SMTP_USERNAME"),
+		os.Getenv("SMTP_PASSWORD"),
+		getEnv("MAIL_FROM", "no-reply@kylerjacobson.dev"),
+	)
+}
+
+// parseWidths reads a comma separated list of image widths such as "320,640".
+func parseWidths(value string) []int {
+	var widths []int
+	for _, field := range strings.Split(value, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		width, err := strconv.Atoi(field)
+		if err != nil || width <= 0 {
+			log.Fatalf("invalid image width %q", field)
+		}
+		widths = append(widths, width)
+	}
+	return widths
+}
+
+// parseDuration reads a duration such as "15m" from the environment.
+func parseDuration(key, fallback string) time.Duration {
+	d, err := time.ParseDuration(getEnv(key, fallback))
+	if err != nil || d <= 0 {
+		log.Fatalf("invalid %s: must be a positive duration such as 15m", key)
+	}
+	return d
+}
+
+// parseUploadPolicy reads the per-role upload allowlist as JSON from the
+// environment, falling back to media.DefaultUploadPolicy.
+func parseUploadPolicy(key string) media.UploadPolicy {
+	value := os.Getenv(key)
+	if value == "" {
+		return media.DefaultUploadPolicy()
+	}
+	policy, err := media.ParseUploadPolicy([]byte(value))
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return policy
+}
+
+// parseSize reads a size in bytes from the environment.
+func parseSize(key string, fallback int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		log.Fatalf("invalid %s: must be a positive number of bytes", key)
+	}
+	return size
+}
+
+// parsePasswordPolicy reads the minimum password length and the comma
+// separated character classes passwords must contain from the environment.
+func parsePasswordPolicy(minLengthKey, requireKey string) password.Policy {
+	minLength := 0
+	if value := os.Getenv(minLengthKey); value != "" {
+		var err error
+		if minLength, err = strconv.Atoi(value); err != nil {
+			log.Fatalf("invalid %s: must be a number", minLengthKey)
+		}
+	}
+	policy, err := password.Parse(minLength, os.Getenv(requireKey))
+	if err != nil {
+		log.Fatalf("invalid %s or %s: %v", minLengthKey, requireKey, err)
+	}
+	return policy
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
 }
@@ -0,0 +1,29 @@
+package comments
+
+import "time"
+
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+type Comment struct {
+	CommentId int        `json:"comment_id" db:"comment_id"`
+	PostId    int        `json:"post_id" db:"post_id"`
+	ParentId  *int       `json:"parent_id" db:"parent_id"`
+	UserId    int        `json:"user_id" db:"user_id"`
+	Content   string     `json:"content" db:"content"`
+	Status    string     `json:"status" db:"status"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	Replies   []*Comment `json:"replies,omitempty" db:"-"`
+}
+
+type CommentRequest struct {
+	Content  string `json:"content"`
+	ParentId *int   `json:"parent_id"`
+}
+
+type ModerationRequest struct {
+	Status string `json:"status"`
+}
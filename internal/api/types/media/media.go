@@ -5,9 +5,59 @@ import (
 )
 
 type Post struct {
-	PostId      int       `json:"postId" db:"post_id"`
-	BlobName    string    `json:"blobName" db:"blob_name"`
-	ContentType string    `json:"contentType" db:"content_type"`
-	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
-	Restricted  bool      `json:"restricted" db:"restricted"`
+	MediaId          int       `json:"mediaId" db:"media_id"`
+	PostId           int       `json:"postId" db:"post_id"`
+	BlobName         string    `json:"blobName" db:"blob_name"`
+	OriginalFilename string    `json:"originalFilename" db:"original_filename"`
+	ContentHash      string    `json:"contentHash" db:"content_hash"`
+	Size             int64     `json:"size" db:"size"`
+	ContentType      string    `json:"contentType" db:"content_type"`
+	CreatedAt        time.Time `json:"createdAt" db:"created_at"`
+	Restricted       bool      `json:"restricted" db:"restricted"`
+	// Width and Height are zero for non-images and uploads made before
+	// variants were generated.
+	Width    int       `json:"width" db:"-"`
+	Height   int       `json:"height" db:"-"`
+	Variants []Variant `json:"variants" db:"-"`
+	// Url is a signed link to the original, filled in by the media library.
+	Url string `json:"url,omitempty" db:"-"`
+}
+
+// Variant is a resized copy of an image blob.
+type Variant struct {
+	BlobName    string `json:"blobName" db:"blob_name"`
+	Width       int    `json:"width" db:"width"`
+	Height      int    `json:"height" db:"height"`
+	ContentType string `json:"contentType" db:"content_type"`
+	Size        int64  `json:"size" db:"size"`
+}
+
+// NewMedia attaches a stored blob to a post. Blobs are named after the SHA-256
+// of their content, so identical uploads share one blob.
+type NewMedia struct {
+	PostId           int
+	BlobName         string
+	OriginalFilename string
+	ContentHash      string
+	Size             int64
+	ContentType      string
+	Restricted       bool
+	// Width, Height and Variants are only set for a newly stored image.
+	Width    int
+	Height   int
+	Variants []Variant
+}
+
+// MediaQuery filters the admin media library. Nil filters match everything.
+type MediaQuery struct {
+	Limit       int
+	Offset      int
+	PostId      *int
+	ContentType string // matched as a prefix, so "image/" finds every image
+	Restricted  *bool
+}
+
+type MediaPage struct {
+	Media      []Post `json:"media"`
+	NextOffset *int   `json:"nextOffset,omitempty"`
 }
@@ -2,16 +2,32 @@ package posts
 
 import (
 	"time"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/diff"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
 )
 
 type Post struct {
-	PostId     int       `json:"post_id" db:"post_id"`
-	Title      string    `json:"title" db:"title"`
-	Content    string    `json:"content" db:"content"`
-	UserId     int       `json:"userId" db:"user_id"`
-	CreatedAt  time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
-	Restricted bool      `json:"restricted" db:"restricted"`
+	PostId  int    `json:"post_id" db:"post_id"`
+	Slug    string `json:"slug" db:"slug"`
+	Title   string `json:"title" db:"title"`
+	Content string `json:"content" db:"content"`
+	// ContentHTML is Content rendered from Markdown and sanitized, filled in by the handlers.
+	ContentHTML  string     `json:"content_html,omitempty" db:"-"`
+	UserId       int        `json:"userId" db:"user_id"`
+	LastEditedBy *int       `json:"last_edited_by" db:"last_edited_by"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time  `json:"updatedAt" db:"updated_at"`
+	Restricted   bool       `json:"restricted" db:"restricted"`
+	Tags         []string   `json:"tags" db:"tags"`
+	Status       string     `json:"status" db:"status"`
+	PublishAt    *time.Time `json:"publish_at" db:"publish_at"`
 }
 
 type FrontendPostRequest struct {
@@ -21,8 +37,79 @@ type PostRequestBody struct {
 	Title      string `json:"title" db:"title"`
 	Content    string `json:"content" db:"content"`
 	Restricted bool   `json:"restricted" db:"restricted"`
+	// Status defaults to published on create; on update a missing status keeps
+	// the post's current status and PublishAt. Scheduled posts need a PublishAt
+	// in the future when they are created or rescheduled.
+	Status    string     `json:"status" db:"status"`
+	PublishAt *time.Time `json:"publish_at" db:"publish_at"`
+	// Tags replaces the post's tags. On update a missing tags field leaves them unchanged.
+	Tags []string `json:"tags,omitempty" db:"-"`
 }
 
 type CreatedPost struct {
 	PostId int `json:"post_id" db:"post_id"`
 }
+
+// Cursor marks the last post of a page. Pages are ordered by (created_at, post_id)
+// so that posts inserted while a reader is paging never shift later pages.
+type Cursor struct {
+	CreatedAt time.Time `json:"created_at"`
+	PostId    int       `json:"post_id"`
+}
+
+// PostsQuery describes which page of posts to read.
+type PostsQuery struct {
+	Limit  int
+	Cursor *Cursor
+	// Tag limits the page to posts carrying this tag when set.
+	Tag    string
+	Status string
+	// AuthorId limits the page to one author's posts when set.
+	AuthorId int
+}
+
+type PostsPage struct {
+	Posts      []Post `json:"posts"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type SearchQuery struct {
+	Text              string
+	IncludeRestricted bool
+	Limit             int
+	Offset            int
+}
+
+// SearchResult is a post matching a search, with its relevance and <b>-highlighted excerpts.
+type SearchResult struct {
+	Post
+	Rank float32 `json:"rank" db:"rank"`
+	// TitleHighlight and Snippet are HTML: the post's text, escaped, with the
+	// matching words wrapped in <b>.
+	TitleHighlight string `json:"title_highlight" db:"title_highlight"`
+	Snippet        string `json:"snippet" db:"snippet"`
+}
+
+type SearchPage struct {
+	Results    []SearchResult `json:"results"`
+	NextOffset *int           `json:"next_offset,omitempty"`
+}
+
+// Revision is a snapshot of a post written every time the post is created or updated.
+type Revision struct {
+	PostId     int       `json:"post_id" db:"post_id"`
+	Revision   int       `json:"revision" db:"revision"`
+	Title      string    `json:"title" db:"title"`
+	Content    string    `json:"content" db:"content"`
+	Restricted bool      `json:"restricted" db:"restricted"`
+	EditedBy   int       `json:"edited_by" db:"edited_by"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+type RevisionDiff struct {
+	From              int          `json:"from"`
+	To                int          `json:"to"`
+	Title             []diff.Chunk `json:"title"`
+	Content           []diff.Chunk `json:"content"`
+	RestrictedChanged bool         `json:"restricted_changed"`
+}
@@ -0,0 +1,6 @@
+package tags
+
+type Tag struct {
+	Name      string `json:"name" db:"name"`
+	PostCount int    `json:"post_count" db:"post_count"`
+}
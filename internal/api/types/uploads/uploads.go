@@ -0,0 +1,18 @@
+package uploads
+
+import "time"
+
+// Upload is a resumable upload. It is complete once Offset reaches Length,
+// and MediaId is set once the file has been attached to its post.
+type Upload struct {
+	UploadId   string    `json:"uploadId" db:"upload_id"`
+	UserId     int       `json:"userId" db:"user_id"`
+	PostId     int       `json:"postId" db:"post_id"`
+	Filename   string    `json:"filename" db:"filename"`
+	Restricted bool      `json:"restricted" db:"restricted"`
+	Length     int64     `json:"length" db:"upload_length"`
+	Offset     int64     `json:"offset" db:"upload_offset"`
+	MediaId    *int      `json:"mediaId" db:"media_id"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+}
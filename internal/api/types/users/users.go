@@ -20,6 +20,13 @@ type User struct {
 	Email             string `json:"email" db:"email"`
 	Role              int    `json:"role" db:"role"`
 	EmailNotification bool   `json:"emailNotification" db:"email_notification"`
+	EmailVerified     bool   `json:"emailVerified" db:"email_verified"`
+	// PasswordResetRequired is set by an admin to make the user choose a new
+	// password before signing in again.
+	PasswordResetRequired bool `json:"passwordResetRequired" db:"password_reset_required"`
+	// SessionVersion goes into session tokens; tokens with an older version
+	// are no longer accepted.
+	SessionVersion int `json:"-" db:"session_version"`
 }
 
 type AccountCreationRequest struct {
@@ -52,11 +59,47 @@ type UserLogin struct {
 }
 
 type FrontendUser struct {
-	Id                string    `json:"id" db:"id"`
-	FirstName         string    `json:"firstName" db:"first_name"`
-	LastName          string    `json:"lastName" db:"last_name"`
-	Email             string    `json:"email" db:"email"`
-	CreatedAt         time.Time `json:"createdAt" db:"created_at"`
-	Role              int       `json:"role" db:"role"`
-	EmailNotification bool      `json:"emailNotification" db:"email_notification"`
+	Id                    string     `json:"id" db:"id"`
+	FirstName             string     `json:"firstName" db:"first_name"`
+	LastName              string     `json:"lastName" db:"last_name"`
+	Email                 string     `json:"email" db:"email"`
+	CreatedAt             time.Time  `json:"createdAt" db:"created_at"`
+	Role                  int        `json:"role" db:"role"`
+	EmailNotification     bool       `json:"emailNotification" db:"email_notification"`
+	EmailVerifiedAt       *time.Time `json:"emailVerifiedAt" db:"email_verified_at"`
+	PasswordResetRequired bool       `json:"passwordResetRequired" db:"password_reset_required"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type PasswordResetConfirm struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// AccessRequest is a request for a role above the default, made at sign up
+// and decided by an admin.
+type AccessRequest struct {
+	RequestId     int        `json:"requestId" db:"request_id"`
+	UserId        int        `json:"userId" db:"user_id"`
+	FirstName     string     `json:"firstName" db:"first_name"`
+	LastName      string     `json:"lastName" db:"last_name"`
+	Email         string     `json:"email" db:"email"`
+	RequestedRole int        `json:"requestedRole" db:"requested_role"`
+	Status        string     `json:"status" db:"status"`
+	Reason        *string    `json:"reason" db:"reason"`
+	DecidedBy     *int       `json:"decidedBy" db:"decided_by"`
+	DecidedAt     *time.Time `json:"decidedAt" db:"decided_at"`
+	CreatedAt     time.Time  `json:"createdAt" db:"created_at"`
+}
+
+type AccessRequestDecision struct {
+	Reason string `json:"reason"`
 }
@@ -1,21 +1,39 @@
 package authorization
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type UserClaim struct {
-	Sub  int `json:"sub"`
-	Role int `json:"role"`
+	Sub  int       `json:"sub"`
+	Role rbac.Role `json:"role"`
+	// Version is the user's session version when the token was issued.
+	Version int `json:"ver"`
 	jwt.RegisteredClaims
 }
 
+// sessionState looks up a user's current role and the session version their
+// tokens must carry.
+var sessionState func(userId int) (rbac.Role, int, error)
+
+// SetSessionLookup makes DecodeToken reject tokens whose version is older than
+// the one lookup returns, which is how a password change signs a user out
+// everywhere, and take the role from lookup rather than the token, so role
+// changes apply straight away. Call it once at start up; until then tokens
+// are trusted as they are.
+func SetSessionLookup(lookup func(userId int) (rbac.Role, int, error)) {
+	sessionState = lookup
+}
+
 func VerifyToken(w http.ResponseWriter, r *http.Request) {
 	token := r.Header.Get("Authorization")
 	if strings.HasPrefix(token, "Bearer ") {
@@ -28,9 +46,7 @@ func VerifyToken(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Fatal(err)
-	} else if claims, ok := parsedToken.Claims.(*UserClaim); ok {
-		fmt.Println(claims.Sub, claims.RegisteredClaims.Issuer)
-	} else {
+	} else if _, ok := parsedToken.Claims.(*UserClaim); !ok {
 		log.Fatal("unknown claims type, cannot proceed")
 	}
 }
@@ -46,7 +62,9 @@ func DecodeToken(token string) *UserClaim {
 	if err != nil {
 		return nil
 	} else if claims, ok := parsedToken.Claims.(*UserClaim); ok {
-		fmt.Println(claims.Sub, claims.RegisteredClaims.Issuer)
+		if !refresh(claims) {
+			return nil
+		}
 		return claims
 	} else {
 		log.Fatal("unknown claims type, cannot proceed")
@@ -54,14 +72,88 @@ func DecodeToken(token string) *UserClaim {
 	}
 }
 
-func CheckPrivilege(token string) bool {
+// refresh replaces the role in claims with the user's current one. It reports
+// false when the token was issued before the user's sessions were last
+// invalidated, or the lookup failed.
+func refresh(claims *UserClaim) bool {
+	if sessionState == nil {
+		return true
+	}
+	role, version, err := sessionState(claims.Sub)
+	if err != nil || claims.Version < version {
+		return false
+	}
+	claims.Role = role
+	return true
+}
+
+// requestClaims remembers the claims decoded for a request's session token.
+type requestClaims struct {
+	mu     sync.Mutex
+	token  string
+	claims *UserClaim
+	done   bool
+}
+
+type requestClaimsKey struct{}
+
+// CacheClaims lets RequestClaims decode a session token once per request
+// rather than on every call.
+func CacheClaims(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestClaimsKey{}, &requestClaims{})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequestClaims is DecodeToken for a token used while serving a request.
+// Behind CacheClaims the result is reused for the rest of the request; the
+// claims are shared, so callers must not modify them.
+func RequestClaims(ctx context.Context, token string) *UserClaim {
+	cache, ok := ctx.Value(requestClaimsKey{}).(*requestClaims)
+	if !ok {
+		return DecodeToken(token)
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if !cache.done || cache.token != token {
+		cache.token, cache.claims, cache.done = token, DecodeToken(token), true
+	}
+	return cache.claims
+}
+
+func CheckPrivilege(ctx context.Context, token string) bool {
 	if len(token) == 0 {
 		return false
 	}
-	claims := DecodeToken(token)
-	// TODO make constants
-	if claims.Role == 1 || claims.Role == 2 {
-		return true
+	return HasPermission(RequestClaims(ctx, token), rbac.PostReadRestricted)
+}
+
+// HasPermission reports whether the session's role grants perm. A request
+// without a session has no permissions.
+func HasPermission(claims *UserClaim, perm rbac.Permission) bool {
+	return claims != nil && rbac.Can(claims.Role, perm)
+}
+
+// CanModifyPost reports whether the session may update a post written by
+// authorId. Only the author and roles with post:update:any may; anyone else
+// gets a 403, and a request without a session gets a 401.
+func CanModifyPost(claims *UserClaim, authorId int) error {
+	return canActOnPost(claims, authorId, rbac.PostUpdateAny, "modify")
+}
+
+// CanDeletePost is CanModifyPost for deleting a post, which other users need
+// post:delete:any for.
+func CanDeletePost(claims *UserClaim, authorId int) error {
+	return canActOnPost(claims, authorId, rbac.PostDeleteAny, "delete")
+}
+
+func canActOnPost(claims *UserClaim, authorId int, anyPost rbac.Permission, verb string) error {
+	if claims == nil {
+		return httperr.New(http.StatusUnauthorized, "Unauthorized", "You must be logged in to "+verb+" this post")
+	}
+	if claims.Sub != authorId && !HasPermission(claims, anyPost) {
+		return httperr.New(http.StatusForbidden, "Forbidden", "Only the author of this post or an admin can "+verb+" it")
 	}
-	return false
+	return nil
 }
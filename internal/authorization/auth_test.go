@@ -0,0 +1,87 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanModifyPost(t *testing.T) {
+	rbac.SetCustomRoles([]rbac.Definition{{Id: 3, Name: "editor", Permissions: []rbac.Permission{rbac.PostUpdateAny}}})
+	defer rbac.SetCustomRoles(nil)
+	tests := []struct {
+		name           string
+		claims         *UserClaim
+		authorId       int
+		delete         bool
+		expectedStatus int
+	}{
+		{name: "no_session", claims: nil, authorId: 7, expectedStatus: http.StatusUnauthorized},
+		{name: "author", claims: &UserClaim{Sub: 7, Role: 0}, authorId: 7},
+		{name: "admin", claims: &UserClaim{Sub: 3, Role: 1}, authorId: 7},
+		{name: "privileged_non_author", claims: &UserClaim{Sub: 3, Role: 2}, authorId: 7, expectedStatus: http.StatusForbidden},
+		{name: "non_privileged_non_author", claims: &UserClaim{Sub: 3, Role: 0}, authorId: 7, expectedStatus: http.StatusForbidden},
+		{name: "custom_role_with_update_any", claims: &UserClaim{Sub: 3, Role: 3}, authorId: 7},
+		{name: "custom_role_deleting", claims: &UserClaim{Sub: 3, Role: 3}, authorId: 7, delete: true, expectedStatus: http.StatusForbidden},
+		{name: "admin_deleting", claims: &UserClaim{Sub: 3, Role: 1}, authorId: 7, delete: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := CanModifyPost
+			if tt.delete {
+				check = CanDeletePost
+			}
+			err := check(tt.claims, tt.authorId)
+			if tt.expectedStatus == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			var httpErr *httperr.Error
+			assert.True(t, errors.As(err, &httpErr))
+			assert.Equal(t, tt.expectedStatus, httpErr.Status)
+		})
+	}
+}
+
+func TestDecodeTokenSessionState(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	lookups := 0
+	SetSessionLookup(func(userId int) (rbac.Role, int, error) {
+		lookups++
+		if userId == 9 {
+			return 0, 0, errors.New("no rows in result set")
+		}
+		return rbac.RoleAdmin, 2, nil
+	})
+	defer SetSessionLookup(nil)
+
+	sign := func(sub, version int) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": sub, "role": 0, "ver": version}).SignedString([]byte("secret"))
+		assert.NoError(t, err)
+		return token
+	}
+	claims := DecodeToken(sign(7, 2))
+	if assert.NotNil(t, claims, "current version") {
+		assert.Equal(t, rbac.RoleAdmin, claims.Role, "role from the lookup, not the token")
+	}
+	assert.Nil(t, DecodeToken(sign(7, 1)), "issued before the sessions were invalidated")
+	assert.Nil(t, DecodeToken(sign(9, 2)), "failed lookup")
+
+	lookups = 0
+	token := sign(7, 2)
+	var ctx context.Context
+	CacheClaims(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { ctx = r.Context() })).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	first := RequestClaims(ctx, token)
+	assert.Same(t, first, RequestClaims(ctx, token))
+	assert.True(t, CheckPrivilege(ctx, token))
+	assert.Equal(t, 1, lookups, "decoded once per request")
+	assert.Nil(t, RequestClaims(ctx, sign(7, 1)), "a different token is decoded again")
+}
@@ -0,0 +1,95 @@
+package comments
+
+import (
+	"context"
+
+	comment_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/comments"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CommentsRepository interface {
+	GetApprovedComments(postId int) ([]comment_models.Comment, error)
+	GetPendingComments() ([]comment_models.Comment, error)
+	CreateComment(postId, userId int, comment comment_models.CommentRequest) (int, error)
+	ModerateComment(commentId int, status string, moderatorId int) error
+}
+
+type commentsRepository struct {
+	conn   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func New(conn *pgxpool.Pool, logger logger.Logger) *commentsRepository {
+	return &commentsRepository{
+		conn:   conn,
+		logger: logger,
+	}
+}
+
+const commentColumns = `comment_id, post_id, parent_id, user_id, content, status, created_at`
+
+func (repository *commentsRepository) GetApprovedComments(postId int) ([]comment_models.Comment, error) {
+	rows, err := repository.conn.Query(
+		context.TODO(), `SELECT `+commentColumns+` FROM comments WHERE post_id = $1 AND status = 'approved' ORDER BY created_at, comment_id`, postId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments, err := pgx.CollectRows(rows, pgx.RowToStructByName[comment_models.Comment])
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error getting comments for post %d: %v", postId, err)
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (repository *commentsRepository) GetPendingComments() ([]comment_models.Comment, error) {
+	rows, err := repository.conn.Query(
+		context.TODO(), `SELECT `+commentColumns+` FROM comments WHERE status = 'pending' ORDER BY created_at, comment_id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	comments, err := pgx.CollectRows(rows, pgx.RowToStructByName[comment_models.Comment])
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error getting pending comments: %v", err)
+		return nil, err
+	}
+	return comments, nil
+}
+
+// CreateComment stores a new comment awaiting moderation. A reply whose parent
+// isn't a comment on the same post returns pgx.ErrNoRows.
+func (repository *commentsRepository) CreateComment(postId, userId int, comment comment_models.CommentRequest) (int, error) {
+	var commentId int
+	err := repository.conn.QueryRow(
+		context.TODO(), `INSERT INTO comments (post_id, parent_id, user_id, content)
+		SELECT $1, $2::int, $3, $4
+		WHERE $2::int IS NULL OR EXISTS (SELECT 1 FROM comments WHERE comment_id = $2::int AND post_id = $1)
+		RETURNING comment_id`, postId, comment.ParentId, userId, comment.Content,
+	).Scan(&commentId)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error creating comment on post %d: %v", postId, err)
+		return 0, err
+	}
+	repository.logger.Sugar().Infof("Created comment %d on post %d", commentId, postId)
+	return commentId, nil
+}
+
+func (repository *commentsRepository) ModerateComment(commentId int, status string, moderatorId int) error {
+	tag, err := repository.conn.Exec(
+		context.TODO(), `UPDATE comments SET status = $1, moderated_by = $2, moderated_at = now() WHERE comment_id = $3`, status, moderatorId, commentId,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error moderating comment %d: %v", commentId, err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return nil
+}
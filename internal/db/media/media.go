@@ -3,6 +3,9 @@ package media
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	media_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/media"
 	"github.com/KylerJacobson/Go-Blog-API/logger"
@@ -12,9 +15,22 @@ import (
 
 type MediaRepository interface {
 	GetMediaByPostId(postId int) ([]media_models.Post, error)
-	UploadMedia(postId int, blobName, contentType string, restricted bool) error
+	ReserveBlob(blobName string) (bool, error)
+	ReleaseBlob(blobName string) error
+	UploadMedia(media media_models.NewMedia) (int, error)
+	DeleteMedia(mediaId int) (*media_models.Post, []string, error)
+	GetMediaById(mediaId int) (*media_models.Post, error)
+	ListMedia(query media_models.MediaQuery) ([]media_models.Post, error)
+	DeleteMediaWithoutPost() (int64, error)
+	ReleaseUnreferencedBlobs(staleBefore time.Time) ([]string, error)
+	KnownBlobs(blobNames []string) (map[string]bool, error)
 }
 
+// mediaColumns lists the media columns in media_models.Post order. Rows
+// uploaded before content addressing have no hash or size.
+const mediaColumns = `media_id, post_id, blob_name, original_filename, COALESCE(content_hash, '') AS content_hash,
+	COALESCE(size, 0) AS size, content_type, created_at, restricted`
+
 type mediaRepository struct {
 	conn   *pgxpool.Pool
 	logger logger.Logger
@@ -30,7 +46,7 @@ func New(conn *pgxpool.Pool, logger logger.Logger) *mediaRepository {
 func (repository *mediaRepository) GetMediaByPostId(postId int) ([]media_models.Post, error) {
 	repository.logger.Sugar().Infof("getting media for post %s from the database", postId)
 	rows, err := repository.conn.Query(
-		context.TODO(), `SELECT post_id, blob_name, content_type, created_at, restricted FROM media WHERE post_id = $1`, postId,
+		context.TODO(), `SELECT `+mediaColumns+` FROM media WHERE post_id = $1 ORDER BY media_id`, postId,
 	)
 	if err != nil {
 		return nil, err
@@ -47,18 +63,348 @@ func (repository *mediaRepository) GetMediaByPostId(postId int) ([]media_models.
 		return nil, err
 
 	}
+	if err = repository.attachImageDetails(media); err != nil {
+		repository.logger.Sugar().Errorf("Error getting image variants for post %d: %v ", postId, err)
+		return nil, err
+	}
 	return media, nil
 }
 
-func (repository *mediaRepository) UploadMedia(postId int, blobName, contentType string, restricted bool) error {
+// attachImageDetails fills in the dimensions and resized variants of each
+// image in media.
+func (repository *mediaRepository) attachImageDetails(media []media_models.Post) error {
+	if len(media) == 0 {
+		return nil
+	}
+	blobNames := make([]string, len(media))
+	for i, m := range media {
+		blobNames[i] = m.BlobName
+	}
+	type dimensions struct {
+		Width  int
+		Height int
+	}
+	sizes := map[string]dimensions{}
 	rows, err := repository.conn.Query(
-		context.TODO(), `INSERT INTO media (post_id, blob_name, content_type, restricted) VALUES ($1, $2, $3, $4) RETURNING *`, postId, blobName, contentType, restricted,
+		context.TODO(), `SELECT blob_name, width, height FROM media_blobs
+		WHERE blob_name = ANY($1) AND width IS NOT NULL`, blobNames,
 	)
 	if err != nil {
-		repository.logger.Sugar().Errorf("Error creating adding media to post %d : %v", postId, err)
 		return err
 	}
-	defer rows.Close()
-	repository.logger.Sugar().Infof("Created post media entry for post %d", postId)
+	var blobName string
+	var size dimensions
+	_, err = pgxV5.ForEachRow(rows, []any{&blobName, &size.Width, &size.Height}, func() error {
+		sizes[blobName] = size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	variants := map[string][]media_models.Variant{}
+	rows, err = repository.conn.Query(
+		context.TODO(), `SELECT source_blob_name, blob_name, width, height, content_type, size FROM media_variants
+		WHERE source_blob_name = ANY($1) ORDER BY width, content_type`, blobNames,
+	)
+	if err != nil {
+		return err
+	}
+	var variant media_models.Variant
+	_, err = pgxV5.ForEachRow(rows, []any{&blobName, &variant.BlobName, &variant.Width, &variant.Height, &variant.ContentType, &variant.Size}, func() error {
+		variants[blobName] = append(variants[blobName], variant)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range media {
+		media[i].Width = sizes[media[i].BlobName].Width
+		media[i].Height = sizes[media[i].BlobName].Height
+		media[i].Variants = variants[media[i].BlobName]
+	}
 	return nil
 }
+
+// ReserveBlob keeps the blob from being released while it is written to or
+// reused from storage, until UploadMedia records the media or ReleaseBlob
+// gives the reservation up. It reports whether the blob was already
+// referenced or reserved, in which case it may already be in storage.
+func (repository *mediaRepository) ReserveBlob(blobName string) (bool, error) {
+	var existing bool
+	err := repository.conn.QueryRow(
+		context.TODO(), `INSERT INTO media_blobs (blob_name, ref_count, reserved, reserved_at) VALUES ($1, 0, 1, now())
+		ON CONFLICT (blob_name) DO UPDATE SET reserved = media_blobs.reserved + 1, reserved_at = now()
+		RETURNING ref_count > 0 OR reserved > 1`,
+		blobName,
+	).Scan(&existing)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error reserving blob %s : %v", blobName, err)
+		return false, err
+	}
+	return existing, nil
+}
+
+// ReleaseBlob gives up a reservation taken by ReserveBlob for an upload that
+// failed. A blob left unreferenced is deleted by ReleaseUnreferencedBlobs.
+func (repository *mediaRepository) ReleaseBlob(blobName string) error {
+	_, err := repository.conn.Exec(
+		context.TODO(), `UPDATE media_blobs SET reserved = reserved - 1 WHERE blob_name = $1 AND reserved > 0`, blobName,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error releasing blob %s : %v", blobName, err)
+	}
+	return err
+}
+
+// UploadMedia records the attachment, turning the reservation on its blob
+// taken by ReserveBlob into a reference.
+func (repository *mediaRepository) UploadMedia(media media_models.NewMedia) (int, error) {
+	ctx := context.TODO()
+	tx, err := repository.conn.Begin(ctx)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error starting transaction for media on post %d : %v", media.PostId, err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The row is inserted again if the reconciler gave up on the reservation.
+	_, err = tx.Exec(
+		ctx, `INSERT INTO media_blobs (blob_name, ref_count, width, height) VALUES ($1, 1, NULLIF($2, 0), NULLIF($3, 0))
+		ON CONFLICT (blob_name) DO UPDATE SET ref_count = media_blobs.ref_count + 1, reserved = GREATEST(media_blobs.reserved - 1, 0),
+			width = COALESCE(EXCLUDED.width, media_blobs.width), height = COALESCE(EXCLUDED.height, media_blobs.height)`,
+		media.BlobName, media.Width, media.Height,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error referencing blob %s : %v", media.BlobName, err)
+		return 0, err
+	}
+	for _, variant := range media.Variants {
+		_, err = tx.Exec(
+			ctx, `INSERT INTO media_variants (blob_name, source_blob_name, width, height, content_type, size)
+			VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (blob_name) DO NOTHING`,
+			variant.BlobName, media.BlobName, variant.Width, variant.Height, variant.ContentType, variant.Size,
+		)
+		if err != nil {
+			repository.logger.Sugar().Errorf("Error recording variant %s : %v", variant.BlobName, err)
+			return 0, err
+		}
+	}
+	var mediaId int
+	err = tx.QueryRow(
+		ctx, `INSERT INTO media (post_id, blob_name, original_filename, content_hash, size, content_type, restricted)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING media_id`,
+		media.PostId, media.BlobName, media.OriginalFilename, media.ContentHash, media.Size, media.ContentType, media.Restricted,
+	).Scan(&mediaId)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error creating adding media to post %d : %v", media.PostId, err)
+		return 0, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		repository.logger.Sugar().Errorf("Error committing media for post %d : %v", media.PostId, err)
+		return 0, err
+	}
+	repository.logger.Sugar().Infof("Created post media entry for post %d", media.PostId)
+	return mediaId, nil
+}
+
+// DeleteMedia removes the attachment and drops its reference on the blob. When
+// that was the last reference it returns the names of the blob and its
+// variants, which the caller should delete from storage. A missing row
+// returns a nil post.
+func (repository *mediaRepository) DeleteMedia(mediaId int) (*media_models.Post, []string, error) {
+	ctx := context.TODO()
+	tx, err := repository.conn.Begin(ctx)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error starting transaction to delete media %d : %v", mediaId, err)
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `DELETE FROM media WHERE media_id = $1 RETURNING `+mediaColumns, mediaId)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error deleting media %d : %v", mediaId, err)
+		return nil, nil, err
+	}
+	media, err := pgxV5.CollectOneRow(rows, pgxV5.RowToStructByName[media_models.Post])
+	if err != nil {
+		if errors.Is(err, pgxV5.ErrNoRows) {
+			return nil, nil, nil
+		}
+		repository.logger.Sugar().Errorf("Error deleting media %d : %v", mediaId, err)
+		return nil, nil, err
+	}
+	// A blob still reserved by an upload in progress is kept.
+	var refCount int
+	err = tx.QueryRow(
+		ctx, `UPDATE media_blobs SET ref_count = ref_count - 1 WHERE blob_name = $1 RETURNING ref_count + reserved`, media.BlobName,
+	).Scan(&refCount)
+	if err != nil && !errors.Is(err, pgxV5.ErrNoRows) {
+		repository.logger.Sugar().Errorf("Error releasing blob %s : %v", media.BlobName, err)
+		return nil, nil, err
+	}
+	var orphaned []string
+	if refCount == 0 {
+		rows, err = tx.Query(ctx, `SELECT blob_name FROM media_variants WHERE source_blob_name = $1`, media.BlobName)
+		if err != nil {
+			return nil, nil, err
+		}
+		orphaned, err = pgxV5.CollectRows(rows, pgxV5.RowTo[string])
+		if err != nil {
+			return nil, nil, err
+		}
+		orphaned = append(orphaned, media.BlobName)
+		if _, err = tx.Exec(ctx, `DELETE FROM media_blobs WHERE blob_name = $1`, media.BlobName); err != nil {
+			repository.logger.Sugar().Errorf("Error deleting blob record %s : %v", media.BlobName, err)
+			return nil, nil, err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		repository.logger.Sugar().Errorf("Error committing deletion of media %d : %v", mediaId, err)
+		return nil, nil, err
+	}
+	repository.logger.Sugar().Infof("Deleted media %d from post %d", mediaId, media.PostId)
+	return &media, orphaned, nil
+}
+
+func (repository *mediaRepository) GetMediaById(mediaId int) (*media_models.Post, error) {
+	rows, err := repository.conn.Query(context.TODO(), `SELECT `+mediaColumns+` FROM media WHERE media_id = $1`, mediaId)
+	if err != nil {
+		return nil, err
+	}
+	media, err := pgxV5.CollectOneRow(rows, pgxV5.RowToStructByName[media_models.Post])
+	if err != nil {
+		if !errors.Is(err, pgxV5.ErrNoRows) {
+			repository.logger.Sugar().Errorf("Error getting media %d: %v ", mediaId, err)
+		}
+		return nil, err
+	}
+	return &media, nil
+}
+
+// ListMedia returns a page of the media library, newest first.
+func (repository *mediaRepository) ListMedia(query media_models.MediaQuery) ([]media_models.Post, error) {
+	var conditions []string
+	var args []any
+	if query.PostId != nil {
+		args = append(args, *query.PostId)
+		conditions = append(conditions, fmt.Sprintf("post_id = $%d", len(args)))
+	}
+	if query.ContentType != "" {
+		args = append(args, query.ContentType)
+		conditions = append(conditions, fmt.Sprintf("starts_with(content_type, $%d)", len(args)))
+	}
+	if query.Restricted != nil {
+		args = append(args, *query.Restricted)
+		conditions = append(conditions, fmt.Sprintf("restricted = $%d", len(args)))
+	}
+	sql := `SELECT ` + mediaColumns + ` FROM media`
+	if len(conditions) > 0 {
+		sql += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, query.Limit, query.Offset)
+	sql += fmt.Sprintf(` ORDER BY media_id DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	rows, err := repository.conn.Query(context.TODO(), sql, args...)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error listing media: %v", err)
+		return nil, err
+	}
+	media, err := pgxV5.CollectRows(rows, pgxV5.RowToStructByName[media_models.Post])
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error listing media: %v", err)
+		return nil, err
+	}
+	if err = repository.attachImageDetails(media); err != nil {
+		repository.logger.Sugar().Errorf("Error getting image variants: %v", err)
+		return nil, err
+	}
+	return media, nil
+}
+
+// DeleteMediaWithoutPost removes attachments whose post has been deleted. The
+// blob references they held are released by ReleaseUnreferencedBlobs.
+func (repository *mediaRepository) DeleteMediaWithoutPost() (int64, error) {
+	tag, err := repository.conn.Exec(
+		context.TODO(), `DELETE FROM media m WHERE NOT EXISTS (SELECT 1 FROM posts p WHERE p.post_id = m.post_id)`,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error deleting media of deleted posts: %v", err)
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ReleaseUnreferencedBlobs recounts the references on every blob from the media
+// table, which corrects counts left behind by rows removed outside
+// DeleteMedia, and abandons reservations taken before staleBefore. Blobs left
+// with no references or reservations are forgotten, and their names and the
+// names of their variants are returned so they can be deleted from storage.
+func (repository *mediaRepository) ReleaseUnreferencedBlobs(staleBefore time.Time) ([]string, error) {
+	ctx := context.TODO()
+	tx, err := repository.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Block uploads and deletes, which take and drop references, until the
+	// recount is committed so none of their changes are counted over. They
+	// only hold media_blobs briefly; storage is never written while they do.
+	if _, err = tx.Exec(ctx, `LOCK TABLE media_blobs IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `UPDATE media_blobs b SET ref_count = counts.n
+		FROM (SELECT mb.blob_name, count(m.blob_name) AS n FROM media_blobs mb
+			LEFT JOIN media m ON m.blob_name = mb.blob_name GROUP BY mb.blob_name) counts
+		WHERE counts.blob_name = b.blob_name AND b.ref_count <> counts.n`)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error recounting blob references: %v", err)
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `UPDATE media_blobs SET reserved = 0 WHERE reserved > 0 AND reserved_at < $1`, staleBefore)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error abandoning stale blob reservations: %v", err)
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, `SELECT v.blob_name FROM media_variants v
+		JOIN media_blobs b ON b.blob_name = v.source_blob_name WHERE b.ref_count = 0 AND b.reserved = 0
+		UNION ALL
+		SELECT blob_name FROM media_blobs WHERE ref_count = 0 AND reserved = 0`)
+	if err != nil {
+		return nil, err
+	}
+	released, err := pgxV5.CollectRows(rows, pgxV5.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM media_blobs WHERE ref_count = 0 AND reserved = 0`); err != nil {
+		repository.logger.Sugar().Errorf("Error deleting unreferenced blob records: %v", err)
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return released, nil
+}
+
+// KnownBlobs reports which of blobNames are recorded as media, blobs or
+// variants.
+func (repository *mediaRepository) KnownBlobs(blobNames []string) (map[string]bool, error) {
+	rows, err := repository.conn.Query(context.TODO(), `SELECT blob_name FROM media_blobs WHERE blob_name = ANY($1)
+		UNION SELECT blob_name FROM media_variants WHERE blob_name = ANY($1)
+		UNION SELECT blob_name FROM media WHERE blob_name = ANY($1)`, blobNames)
+	if err != nil {
+		return nil, err
+	}
+	names, err := pgxV5.CollectRows(rows, pgxV5.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(names))
+	for _, name := range names {
+		known[name] = true
+	}
+	return known, nil
+}
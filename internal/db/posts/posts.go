@@ -2,22 +2,36 @@ package posts
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
 
 	post_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/posts"
+	"github.com/KylerJacobson/Go-Blog-API/internal/slug"
 	"github.com/KylerJacobson/Go-Blog-API/logger"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type PostsRepository interface {
-	GetRecentPosts() ([]post_models.Post, error)
-	GetRecentPublicPosts() ([]post_models.Post, error)
+	GetRecentPosts(query post_models.PostsQuery) ([]post_models.Post, error)
+	GetRecentPublicPosts(query post_models.PostsQuery) ([]post_models.Post, error)
 	GetPostById(postId int) (*post_models.Post, error)
+	GetPostBySlug(slug string) (*post_models.Post, error)
 	DeletePostById(postId int) error
 	CreatePost(post post_models.PostRequestBody, userId int) (int, error)
-	UpdatePost(post post_models.PostRequestBody, postId, userId int) (*post_models.PostRequestBody, error)
+	UpdatePost(post post_models.PostRequestBody, postId, editorId int) (*post_models.PostRequestBody, error)
+	SearchPosts(query post_models.SearchQuery) ([]post_models.SearchResult, error)
+	PublishScheduledPosts() (int64, error)
+	GetRevisions(postId int) ([]post_models.Revision, error)
+	GetRevision(postId, revision int) (*post_models.Revision, error)
 }
 
+const postColumns = `post_id, slug, title, content, user_id, created_at, updated_at, restricted,
+	ARRAY(SELECT t.name FROM post_tags pt JOIN tags t ON t.tag_id = pt.tag_id WHERE pt.post_id = posts.post_id ORDER BY t.name) AS tags,
+	status, publish_at, last_edited_by`
+
 type postsRepository struct {
 	conn   *pgxpool.Pool
 	logger logger.Logger
@@ -30,18 +44,10 @@ func New(conn *pgxpool.Pool, logger logger.Logger) *postsRepository {
 	}
 }
 
-func (repository *postsRepository) GetRecentPosts() ([]post_models.Post, error) {
+func (repository *postsRepository) GetRecentPosts(query post_models.PostsQuery) ([]post_models.Post, error) {
 	repository.logger.Sugar().Infof("getting posts from the database")
 
-	rows, err := repository.conn.Query(
-		context.TODO(), `SELECT post_id, title, content, user_id, created_at, updated_at, restricted FROM posts ORDER BY created_at DESC LIMIT 10;`,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	posts, err := pgx.CollectRows(rows, pgx.RowToStructByName[post_models.Post])
+	posts, err := repository.listPosts(false, query)
 	if err != nil {
 		repository.logger.Sugar().Errorf("Error getting recent posts from the database: %v", err)
 		return nil, err
@@ -52,18 +58,10 @@ func (repository *postsRepository) GetRecentPosts() ([]post_models.Post, error)
 	return posts, nil
 }
 
-func (repository *postsRepository) GetRecentPublicPosts() ([]post_models.Post, error) {
+func (repository *postsRepository) GetRecentPublicPosts(query post_models.PostsQuery) ([]post_models.Post, error) {
 	repository.logger.Sugar().Info("getting public posts from the database")
 
-	rows, err := repository.conn.Query(
-		context.TODO(), `SELECT post_id, title, content, user_id, created_at, updated_at, restricted FROM posts WHERE restricted = false ORDER BY created_at DESC LIMIT 10`,
-	)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	posts, err := pgx.CollectRows(rows, pgx.RowToStructByName[post_models.Post])
+	posts, err := repository.listPosts(true, query)
 	if err != nil {
 		repository.logger.Sugar().Errorf("Error getting recent public posts from the database: %v ", err)
 		return nil, err
@@ -74,10 +72,47 @@ func (repository *postsRepository) GetRecentPublicPosts() ([]post_models.Post, e
 	return posts, nil
 }
 
+// listPosts pages through posts newest first using keyset pagination on
+// (created_at, post_id), which keeps pages stable while new posts are inserted.
+func (repository *postsRepository) listPosts(publicOnly bool, query post_models.PostsQuery) ([]post_models.Post, error) {
+	status := query.Status
+	if status == "" {
+		status = post_models.StatusPublished
+	}
+	args := []any{status}
+	conditions := []string{"status = $1"}
+	if query.AuthorId != 0 {
+		args = append(args, query.AuthorId)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if publicOnly {
+		conditions = append(conditions, "restricted = false")
+	}
+	if query.Tag != "" {
+		args = append(args, query.Tag)
+		conditions = append(conditions, fmt.Sprintf("EXISTS (SELECT 1 FROM post_tags pt JOIN tags t ON t.tag_id = pt.tag_id WHERE pt.post_id = posts.post_id AND t.name = $%d)", len(args)))
+	}
+	if query.Cursor != nil {
+		args = append(args, query.Cursor.CreatedAt, query.Cursor.PostId)
+		conditions = append(conditions, fmt.Sprintf("(created_at, post_id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	where := "WHERE " + strings.Join(conditions, " AND ")
+	args = append(args, query.Limit)
+	sql := fmt.Sprintf(`SELECT %s FROM posts %s ORDER BY created_at DESC, post_id DESC LIMIT $%d`, postColumns, where, len(args))
+
+	rows, err := repository.conn.Query(context.TODO(), sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[post_models.Post])
+}
+
 func (repository *postsRepository) GetPostById(postId int) (*post_models.Post, error) {
 
 	rows, err := repository.conn.Query(
-		context.TODO(), `SELECT post_id, title, content, user_id, created_at, updated_at, restricted FROM posts WHERE post_id = $1`, postId,
+		context.TODO(), `SELECT `+postColumns+` FROM posts WHERE post_id = $1`, postId,
 	)
 	if err != nil {
 		return nil, err
@@ -91,6 +126,26 @@ func (repository *postsRepository) GetPostById(postId int) (*post_models.Post, e
 	return &post, nil
 }
 
+// GetPostBySlug finds a post by its current slug or by one of its old slugs.
+// Callers can tell the two apart by comparing the requested slug with post.Slug.
+func (repository *postsRepository) GetPostBySlug(slug string) (*post_models.Post, error) {
+	rows, err := repository.conn.Query(
+		context.TODO(), `SELECT `+postColumns+` FROM posts
+		WHERE slug = $1 OR post_id = (SELECT post_id FROM post_slug_redirects WHERE slug = $1)
+		ORDER BY slug = $1 DESC LIMIT 1`, slug,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	post, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[post_models.Post])
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error getting post by slug %s: %v ", slug, err)
+		return nil, err
+	}
+	return &post, nil
+}
+
 func (repository *postsRepository) DeletePostById(postId int) error {
 	rows, err := repository.conn.Query(
 		context.TODO(), `DELETE FROM posts WHERE post_id = $1`, postId,
@@ -103,8 +158,23 @@ func (repository *postsRepository) DeletePostById(postId int) error {
 }
 
 func (repository *postsRepository) CreatePost(post post_models.PostRequestBody, userId int) (int, error) {
-	rows, err := repository.conn.Query(
-		context.TODO(), `INSERT INTO posts (title, content, restricted, user_id) VALUES ($1, $2, $3, $4) RETURNING post_id`, post.Title, post.Content, post.Restricted, userId,
+	ctx := context.TODO()
+	tx, err := repository.conn.Begin(ctx)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error starting transaction for post(%s) : %v", post.Title, err)
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	postSlug, err := uniqueSlug(ctx, tx, slug.Make(post.Title), 0)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error generating slug for post(%s) : %v", post.Title, err)
+		return 0, err
+	}
+	rows, err := tx.Query(
+		ctx, `INSERT INTO posts (title, content, restricted, user_id, status, publish_at, slug)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $5 = 'published' THEN COALESCE($6, now()) ELSE $6 END, $7)
+		RETURNING post_id`, post.Title, post.Content, post.Restricted, userId, post.Status, post.PublishAt, postSlug,
 	)
 	if err != nil {
 		repository.logger.Sugar().Errorf("Error creating post(%s) : %v", post.Title, err)
@@ -115,26 +185,251 @@ func (repository *postsRepository) CreatePost(post post_models.PostRequestBody,
 		repository.logger.Sugar().Errorf("Error returning postId for post(%s) : %v", post.Title, err)
 		return 0, err
 	}
-	defer rows.Close()
+	if err = setPostTags(ctx, tx, newPost[0].PostId, post.Tags); err != nil {
+		repository.logger.Sugar().Errorf("Error tagging post(%s) : %v", post.Title, err)
+		return 0, err
+	}
+	if err = insertRevision(ctx, tx, newPost[0].PostId, userId); err != nil {
+		repository.logger.Sugar().Errorf("Error recording revision of post(%s) : %v", post.Title, err)
+		return 0, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		repository.logger.Sugar().Errorf("Error committing post(%s) : %v", post.Title, err)
+		return 0, err
+	}
 	repository.logger.Sugar().Infof("Created post %s", post.Title)
 	return newPost[0].PostId, nil
 }
 
-func (repository *postsRepository) UpdatePost(post post_models.PostRequestBody, postId, userId int) (*post_models.PostRequestBody, error) {
-	rows, err := repository.conn.Query(
-		context.TODO(), `UPDATE posts SET title = $1, content = $2, restricted = $3, user_id = $4 WHERE post_id = $5 RETURNING title, content, restricted, user_id`, post.Title, post.Content, post.Restricted, userId, postId,
+// UpdatePost rewrites a post on behalf of editorId. The post keeps its original
+// author; the editor is recorded in last_edited_by and in the new revision.
+// updated_at is bumped too, as the feeds build their ETag and Last-Modified
+// from it.
+func (repository *postsRepository) UpdatePost(post post_models.PostRequestBody, postId, editorId int) (*post_models.PostRequestBody, error) {
+	ctx := context.TODO()
+	tx, err := repository.conn.Begin(ctx)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error starting transaction for post(%s) : %v", post.Title, err)
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	postSlug, err := updateSlug(ctx, tx, postId, post.Title)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			repository.logger.Sugar().Errorf("Error updating slug of post(%s) : %v", post.Title, err)
+		}
+		return nil, err
+	}
+	rows, err := tx.Query(
+		ctx, `UPDATE posts SET title = $1, content = $2, restricted = $3, last_edited_by = $4, status = $6, updated_at = now(),
+			publish_at = CASE WHEN $6 = 'published' THEN COALESCE($7, publish_at, now()) ELSE $7 END, slug = $8
+		WHERE post_id = $5 RETURNING title, content, restricted, status, publish_at`, post.Title, post.Content, post.Restricted, editorId, postId, post.Status, post.PublishAt, postSlug,
 	)
 	if err != nil {
 		repository.logger.Sugar().Errorf("Error updating post(%s) : %v", post.Title, err)
 		return nil, err
 	}
-	defer rows.Close()
 	updatedPost, err := pgx.CollectRows(rows, pgx.RowToStructByName[post_models.PostRequestBody])
 	if err != nil {
 		repository.logger.Sugar().Infof("Error unmarshalling updated post: %s", post.Title)
 		repository.logger.Sugar().Errorf("Error updating post(%s) : %v", post.Title, err)
 		return nil, err
 	}
-	repository.logger.Sugar().Infof("Updated post %s", &updatedPost[0].Title)
+	if len(updatedPost) < 1 {
+		return nil, pgx.ErrNoRows
+	}
+	if post.Tags != nil {
+		if err = setPostTags(ctx, tx, postId, post.Tags); err != nil {
+			repository.logger.Sugar().Errorf("Error tagging post(%s) : %v", post.Title, err)
+			return nil, err
+		}
+	}
+	if err = insertRevision(ctx, tx, postId, editorId); err != nil {
+		repository.logger.Sugar().Errorf("Error recording revision of post(%s) : %v", post.Title, err)
+		return nil, err
+	}
+	err = tx.QueryRow(
+		ctx, `SELECT ARRAY(SELECT t.name FROM post_tags pt JOIN tags t ON t.tag_id = pt.tag_id WHERE pt.post_id = $1 ORDER BY t.name)`, postId,
+	).Scan(&updatedPost[0].Tags)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error reading tags of post(%s) : %v", post.Title, err)
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		repository.logger.Sugar().Errorf("Error committing post(%s) : %v", post.Title, err)
+		return nil, err
+	}
+	repository.logger.Sugar().Infof("Updated post %s", updatedPost[0].Title)
 	return &updatedPost[0], nil
 }
+
+// setPostTags replaces the tags of a post, creating tags that don't exist yet.
+func setPostTags(ctx context.Context, tx pgx.Tx, postId int, tags []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM post_tags WHERE post_id = $1`, postId); err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING`, tags); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO post_tags (post_id, tag_id) SELECT $1, tag_id FROM tags WHERE name = ANY($2)`, postId, tags)
+	return err
+}
+
+// uniqueSlug returns base, or base with the first free numeric suffix, skipping
+// slugs held by other posts either currently or as redirects.
+func uniqueSlug(ctx context.Context, tx pgx.Tx, base string, postId int) (string, error) {
+	candidate := base
+	for n := 2; ; n++ {
+		if !slug.IsReserved(candidate) {
+			var taken bool
+			err := tx.QueryRow(
+				ctx, `SELECT EXISTS (SELECT 1 FROM posts WHERE slug = $1 AND post_id <> $2)
+				OR EXISTS (SELECT 1 FROM post_slug_redirects WHERE slug = $1 AND post_id <> $2)`, candidate, postId,
+			).Scan(&taken)
+			if err != nil {
+				return "", err
+			}
+			if !taken {
+				return candidate, nil
+			}
+		}
+		candidate = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// updateSlug picks the slug for a post being renamed. When the new title
+// produces a different slug the old one is kept as a redirect to the post.
+func updateSlug(ctx context.Context, tx pgx.Tx, postId int, title string) (string, error) {
+	var currentTitle, currentSlug string
+	err := tx.QueryRow(ctx, `SELECT title, slug FROM posts WHERE post_id = $1 FOR UPDATE`, postId).Scan(&currentTitle, &currentSlug)
+	if err != nil {
+		return "", err
+	}
+	if slug.Make(title) == slug.Make(currentTitle) {
+		return currentSlug, nil
+	}
+	newSlug, err := uniqueSlug(ctx, tx, slug.Make(title), postId)
+	if err != nil {
+		return "", err
+	}
+	// Renaming a post back to an earlier title reclaims its old slug.
+	if _, err = tx.Exec(ctx, `DELETE FROM post_slug_redirects WHERE slug = $1`, newSlug); err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO post_slug_redirects (slug, post_id) VALUES ($1, $2) ON CONFLICT (slug) DO NOTHING`, currentSlug, postId)
+	return newSlug, err
+}
+
+// insertRevision snapshots the current state of a post as its next revision.
+// Callers update the post first so its row lock serialises revision numbers.
+func insertRevision(ctx context.Context, tx pgx.Tx, postId, editorId int) error {
+	_, err := tx.Exec(
+		ctx, `INSERT INTO post_revisions (post_id, revision, title, content, restricted, edited_by)
+		SELECT post_id, COALESCE((SELECT MAX(revision) FROM post_revisions WHERE post_id = $1), 0) + 1, title, content, restricted, $2
+		FROM posts WHERE post_id = $1`, postId, editorId,
+	)
+	return err
+}
+
+func (repository *postsRepository) GetRevisions(postId int) ([]post_models.Revision, error) {
+	rows, err := repository.conn.Query(
+		context.TODO(), `SELECT post_id, revision, title, content, restricted, edited_by, created_at FROM post_revisions WHERE post_id = $1 ORDER BY revision DESC`, postId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revisions, err := pgx.CollectRows(rows, pgx.RowToStructByName[post_models.Revision])
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error getting revisions of post %d: %v ", postId, err)
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (repository *postsRepository) GetRevision(postId, revision int) (*post_models.Revision, error) {
+	rows, err := repository.conn.Query(
+		context.TODO(), `SELECT post_id, revision, title, content, restricted, edited_by, created_at FROM post_revisions WHERE post_id = $1 AND revision = $2`, postId, revision,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rev, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[post_models.Revision])
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error getting revision %d of post %d: %v ", revision, postId, err)
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// SearchPosts ranks posts against a web-search style query using the generated
+// search_vector column, where title matches weigh more than content matches.
+func (repository *postsRepository) SearchPosts(query post_models.SearchQuery) ([]post_models.SearchResult, error) {
+	repository.logger.Sugar().Infof("searching posts for %q", query.Text)
+
+	visibility := ""
+	if !query.IncludeRestricted {
+		visibility = "AND restricted = false"
+	}
+	rows, err := repository.conn.Query(
+		context.TODO(), `SELECT `+postColumns+`,
+			ts_rank(search_vector, q) AS rank,
+			ts_headline('english', translate(title, $4, ''), q, 'HighlightAll=true, '||$5) AS title_highlight,
+			ts_headline('english', translate(content, $4, ''), q, 'MaxFragments=2, MaxWords=30, MinWords=10, '||$5) AS snippet
+		FROM posts, websearch_to_tsquery('english', $1) q
+		WHERE search_vector @@ q AND status = 'published' `+visibility+`
+		ORDER BY rank DESC, post_id DESC
+		LIMIT $2 OFFSET $3`, query.Text, query.Limit, query.Offset,
+		highlightStart+highlightStop, `StartSel="`+highlightStart+`", StopSel="`+highlightStop+`"`,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error searching posts for %q: %v", query.Text, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := pgx.CollectRows(rows, pgx.RowToStructByName[post_models.SearchResult])
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error collecting search results for %q: %v", query.Text, err)
+		return nil, err
+	}
+	for i := range results {
+		results[i].TitleHighlight = highlightHTML(results[i].TitleHighlight)
+		results[i].Snippet = highlightHTML(results[i].Snippet)
+	}
+	return results, nil
+}
+
+// ts_headline marks matches with these private use characters, which are
+// stripped from the source text first, rather than with HTML tags, so the
+// text around them can be escaped.
+const (
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+var highlightReplacer = strings.NewReplacer(highlightStart, "<b>", highlightStop, "</b>")
+
+// highlightHTML turns a ts_headline result into HTML that is safe to render:
+// the post's own text is escaped and only the <b> highlight tags remain.
+func highlightHTML(headline string) string {
+	return highlightReplacer.Replace(html.EscapeString(headline))
+}
+
+// PublishScheduledPosts publishes every scheduled post whose publish_at has passed
+// and returns how many were published. Like UpdatePost it bumps updated_at.
+func (repository *postsRepository) PublishScheduledPosts() (int64, error) {
+	tag, err := repository.conn.Exec(
+		context.TODO(), `UPDATE posts SET status = 'published', updated_at = now() WHERE status = 'scheduled' AND publish_at <= now()`,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error publishing scheduled posts: %v", err)
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,12 @@
+package posts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHighlightHTML(t *testing.T) {
+	headline := `<img src=x onerror=alert(1)> the ` + highlightStart + `search` + highlightStop + ` & more`
+	assert.Equal(t, `&lt;img src=x onerror=alert(1)&gt; the <b>search</b> &amp; more`, highlightHTML(headline))
+}
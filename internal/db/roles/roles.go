@@ -0,0 +1,119 @@
+package roles
+
+import (
+	"context"
+	"errors"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrRoleInUse is returned when deleting a role that users still have.
+	ErrRoleInUse = errors.New("role is assigned to users")
+	// ErrDuplicateName is returned when another role already has the name.
+	ErrDuplicateName = errors.New("a role with this name already exists")
+)
+
+type RolesRepository interface {
+	GetRoles() ([]rbac.Definition, error)
+	SaveRole(role rbac.Definition) error
+	DeleteRole(id rbac.Role) (bool, error)
+}
+
+type rolesRepository struct {
+	conn   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func New(conn *pgxpool.Pool, logger logger.Logger) *rolesRepository {
+	return &rolesRepository{
+		conn:   conn,
+		logger: logger,
+	}
+}
+
+type roleRow struct {
+	Id          int      `db:"role_id"`
+	Name        string   `db:"name"`
+	Permissions []string `db:"permissions"`
+}
+
+// GetRoles returns the custom roles.
+func (repository *rolesRepository) GetRoles() ([]rbac.Definition, error) {
+	rows, err := repository.conn.Query(context.TODO(), `SELECT role_id, name, permissions FROM roles ORDER BY role_id`)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error getting roles: %v", err)
+		return nil, err
+	}
+	roleRows, err := pgx.CollectRows(rows, pgx.RowToStructByName[roleRow])
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error getting roles: %v", err)
+		return nil, err
+	}
+	definitions := make([]rbac.Definition, len(roleRows))
+	for i, row := range roleRows {
+		definitions[i] = rbac.Definition{Id: rbac.Role(row.Id), Name: row.Name, Permissions: make([]rbac.Permission, len(row.Permissions))}
+		for j, perm := range row.Permissions {
+			definitions[i].Permissions[j] = rbac.Permission(perm)
+		}
+	}
+	return definitions, nil
+}
+
+// SaveRole creates the custom role or replaces it if it exists.
+func (repository *rolesRepository) SaveRole(role rbac.Definition) error {
+	permissions := make([]string, len(role.Permissions))
+	for i, perm := range role.Permissions {
+		permissions[i] = string(perm)
+	}
+	_, err := repository.conn.Exec(
+		context.TODO(), `INSERT INTO roles (role_id, name, permissions) VALUES ($1, $2, $3)
+		ON CONFLICT (role_id) DO UPDATE SET name = EXCLUDED.name, permissions = EXCLUDED.permissions, updated_at = now()`,
+		int(role.Id), role.Name, permissions,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrDuplicateName
+		}
+		repository.logger.Sugar().Errorf("Error saving role %d : %v", role.Id, err)
+		return err
+	}
+	return nil
+}
+
+// DeleteRole removes a custom role. It reports false when there is no such
+// role and returns ErrRoleInUse while users still have it.
+func (repository *rolesRepository) DeleteRole(id rbac.Role) (bool, error) {
+	ctx := context.TODO()
+	tx, err := repository.conn.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx, `SELECT true FROM roles WHERE role_id = $1 FOR UPDATE`, int(id)).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	var inUse bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE role = $1)`, int(id)).Scan(&inUse); err != nil {
+		return false, err
+	}
+	if inUse {
+		return false, ErrRoleInUse
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM roles WHERE role_id = $1`, int(id)); err != nil {
+		repository.logger.Sugar().Errorf("Error deleting role %d : %v", id, err)
+		return false, err
+	}
+	return true, tx.Commit(ctx)
+}
@@ -0,0 +1,56 @@
+package tags
+
+import (
+	"context"
+
+	tag_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/tags"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TagsRepository interface {
+	GetTags(includeRestricted bool) ([]tag_models.Tag, error)
+}
+
+type tagsRepository struct {
+	conn   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func New(conn *pgxpool.Pool, logger logger.Logger) *tagsRepository {
+	return &tagsRepository{
+		conn:   conn,
+		logger: logger,
+	}
+}
+
+// GetTags lists every tag used by at least one visible post, most used first.
+func (repository *tagsRepository) GetTags(includeRestricted bool) ([]tag_models.Tag, error) {
+	repository.logger.Sugar().Infof("getting tags from the database")
+
+	visibility := ""
+	if !includeRestricted {
+		visibility = "AND p.restricted = false"
+	}
+	rows, err := repository.conn.Query(
+		context.TODO(), `SELECT t.name, COUNT(p.post_id)::int AS post_count
+		FROM tags t
+		JOIN post_tags pt ON pt.tag_id = t.tag_id
+		JOIN posts p ON p.post_id = pt.post_id
+		WHERE p.status = 'published' `+visibility+`
+		GROUP BY t.name
+		ORDER BY post_count DESC, t.name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags, err := pgx.CollectRows(rows, pgx.RowToStructByName[tag_models.Tag])
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error getting tags from the database: %v", err)
+		return nil, err
+	}
+	return tags, nil
+}
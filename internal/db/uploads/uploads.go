@@ -0,0 +1,109 @@
+package uploads
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	upload_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/uploads"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+	pgxV5 "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type UploadsRepository interface {
+	CreateUpload(upload upload_models.Upload) error
+	GetUpload(uploadId string) (*upload_models.Upload, error)
+	AdvanceOffset(uploadId string, from, to int64) (bool, error)
+	CompleteUpload(uploadId string, mediaId int) error
+	DeleteUpload(uploadId string) error
+	GetStaleUploads(updatedBefore time.Time) ([]upload_models.Upload, error)
+}
+
+const uploadColumns = `upload_id, user_id, post_id, filename, restricted, upload_length, upload_offset, media_id, created_at, updated_at`
+
+type uploadsRepository struct {
+	conn   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func New(conn *pgxpool.Pool, logger logger.Logger) *uploadsRepository {
+	return &uploadsRepository{
+		conn:   conn,
+		logger: logger,
+	}
+}
+
+func (repository *uploadsRepository) CreateUpload(upload upload_models.Upload) error {
+	_, err := repository.conn.Exec(
+		context.TODO(), `INSERT INTO uploads (upload_id, user_id, post_id, filename, restricted, upload_length)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		upload.UploadId, upload.UserId, upload.PostId, upload.Filename, upload.Restricted, upload.Length,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error creating upload %s : %v", upload.UploadId, err)
+		return err
+	}
+	repository.logger.Sugar().Infof("Created upload %s for post %d", upload.UploadId, upload.PostId)
+	return nil
+}
+
+func (repository *uploadsRepository) GetUpload(uploadId string) (*upload_models.Upload, error) {
+	rows, err := repository.conn.Query(context.TODO(), `SELECT `+uploadColumns+` FROM uploads WHERE upload_id = $1`, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := pgxV5.CollectOneRow(rows, pgxV5.RowToStructByName[upload_models.Upload])
+	if err != nil {
+		if !errors.Is(err, pgxV5.ErrNoRows) {
+			repository.logger.Sugar().Errorf("Error getting upload %s : %v", uploadId, err)
+		}
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// AdvanceOffset moves the upload from offset from to offset to. It reports
+// false when the upload is no longer at from, meaning another request got
+// there first.
+func (repository *uploadsRepository) AdvanceOffset(uploadId string, from, to int64) (bool, error) {
+	tag, err := repository.conn.Exec(
+		context.TODO(), `UPDATE uploads SET upload_offset = $3, updated_at = now()
+		WHERE upload_id = $1 AND upload_offset = $2`, uploadId, from, to,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error advancing upload %s : %v", uploadId, err)
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (repository *uploadsRepository) CompleteUpload(uploadId string, mediaId int) error {
+	_, err := repository.conn.Exec(
+		context.TODO(), `UPDATE uploads SET media_id = $2, updated_at = now() WHERE upload_id = $1`, uploadId, mediaId,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error completing upload %s : %v", uploadId, err)
+	}
+	return err
+}
+
+func (repository *uploadsRepository) DeleteUpload(uploadId string) error {
+	_, err := repository.conn.Exec(context.TODO(), `DELETE FROM uploads WHERE upload_id = $1`, uploadId)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error deleting upload %s : %v", uploadId, err)
+	}
+	return err
+}
+
+// GetStaleUploads returns uploads, finished or abandoned, that haven't been
+// touched since updatedBefore.
+func (repository *uploadsRepository) GetStaleUploads(updatedBefore time.Time) ([]upload_models.Upload, error) {
+	rows, err := repository.conn.Query(
+		context.TODO(), `SELECT `+uploadColumns+` FROM uploads WHERE updated_at < $1`, updatedBefore,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return pgxV5.CollectRows(rows, pgxV5.RowToStructByName[upload_models.Upload])
+}
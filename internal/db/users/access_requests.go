@@ -0,0 +1,100 @@
+package users
+
+import (
+	"context"
+	"errors"
+
+	user_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrAccessRequestDecided is returned when deciding a request that was
+// already approved or denied.
+var ErrAccessRequestDecided = errors.New("access request was already decided")
+
+const accessRequestColumns = `r.request_id, r.user_id, u.first_name, u.last_name, u.email, r.requested_role,
+	r.status, r.reason, r.decided_by, r.decided_at, r.created_at`
+
+// ListAccessRequests returns requests with the status, or all requests when
+// status is empty, oldest first.
+func (repository *usersRepository) ListAccessRequests(status string) ([]user_models.AccessRequest, error) {
+	rows, err := repository.conn.Query(
+		context.TODO(), `SELECT `+accessRequestColumns+`
+		FROM access_requests r JOIN users u ON u.id = r.user_id
+		WHERE $1 = '' OR r.status = $1
+		ORDER BY r.created_at ASC`, status,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error listing access requests: %v", err)
+		return nil, err
+	}
+	requests, err := pgx.CollectRows(rows, pgx.RowToStructByName[user_models.AccessRequest])
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error listing access requests: %v", err)
+		return nil, err
+	}
+	return requests, nil
+}
+
+// DecideAccessRequest approves or denies a pending request, granting the
+// requested role on approval. It returns pgx.ErrNoRows when there is no such
+// request and ErrAccessRequestDecided when it isn't pending anymore.
+func (repository *usersRepository) DecideAccessRequest(requestId int, approve bool, reason string, decidedBy int) (*user_models.AccessRequest, error) {
+	ctx := context.TODO()
+	tx, err := repository.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	var userId, requestedRole int
+	err = tx.QueryRow(
+		ctx, `SELECT status, user_id, requested_role FROM access_requests WHERE request_id = $1 FOR UPDATE`, requestId,
+	).Scan(&status, &userId, &requestedRole)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			repository.logger.Sugar().Errorf("Error getting access request %d : %v", requestId, err)
+		}
+		return nil, err
+	}
+	if status != "pending" {
+		return nil, ErrAccessRequestDecided
+	}
+
+	status = "denied"
+	if approve {
+		status = "approved"
+		if _, err := tx.Exec(ctx, `UPDATE users SET role = $1 WHERE id = $2`, requestedRole, userId); err != nil {
+			repository.logger.Sugar().Errorf("Error granting role %d to user %d : %v", requestedRole, userId, err)
+			return nil, err
+		}
+	}
+	var nullableReason *string
+	if reason != "" {
+		nullableReason = &reason
+	}
+	_, err = tx.Exec(
+		ctx, `UPDATE access_requests SET status = $2, reason = $3, decided_by = $4, decided_at = now() WHERE request_id = $1`,
+		requestId, status, nullableReason, decidedBy,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error deciding access request %d : %v", requestId, err)
+		return nil, err
+	}
+	rows, err := tx.Query(
+		ctx, `SELECT `+accessRequestColumns+` FROM access_requests r JOIN users u ON u.id = r.user_id WHERE r.request_id = $1`, requestId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	request, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[user_models.AccessRequest])
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	repository.logger.Sugar().Infof("Access request %d %s by user %d", requestId, status, decidedBy)
+	return &request, nil
+}
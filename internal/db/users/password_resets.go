@@ -0,0 +1,71 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (repository *usersRepository) CreatePasswordReset(userId int, tokenHash string, expiresAt time.Time) error {
+	_, err := repository.conn.Exec(
+		context.TODO(), `INSERT INTO password_resets (token_hash, user_id, expires_at) VALUES ($1, $2, $3)`,
+		tokenHash, userId, expiresAt,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error creating password reset for user %d : %v", userId, err)
+	}
+	return err
+}
+
+// ResetPassword sets a new password for the user a reset token was issued to,
+// hashed the same way as in CreateUser. It reports false when the token is
+// unknown, expired or already used. Every outstanding token of the user is
+// used up, not only this one, and every session of the user is signed out.
+func (repository *usersRepository) ResetPassword(tokenHash string, password string) (bool, error) {
+	ctx := context.TODO()
+	tx, err := repository.conn.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	var userId int
+	err = tx.QueryRow(
+		ctx, `SELECT user_id FROM password_resets
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > now()
+		FOR UPDATE`, tokenHash,
+	).Scan(&userId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		repository.logger.Sugar().Errorf("Error getting password reset: %v", err)
+		return false, err
+	}
+	tag, err := tx.Exec(ctx, `UPDATE users SET password = crypt($1, gen_salt('bf', 8)), password_reset_required = false, session_version = session_version + 1 WHERE id = $2`, password, userId)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error resetting password of user %d : %v", userId, err)
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+	if err := invalidatePasswordResets(ctx, tx, userId); err != nil {
+		repository.logger.Sugar().Errorf("Error invalidating password resets of user %d : %v", userId, err)
+		return false, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	repository.logger.Sugar().Infof("Reset password of user %d", userId)
+	return true, nil
+}
+
+// invalidatePasswordResets uses up the user's outstanding reset tokens. Call
+// it whenever the password changes, so an old reset email stops working.
+func invalidatePasswordResets(ctx context.Context, tx pgx.Tx, userId int) error {
+	_, err := tx.Exec(ctx, `UPDATE password_resets SET used_at = now() WHERE user_id = $1 AND used_at IS NULL`, userId)
+	return err
+}
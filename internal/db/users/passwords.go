@@ -0,0 +1,79 @@
+package users
+
+import (
+	"context"
+	"errors"
+
+	user_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/jackc/pgx/v5"
+)
+
+// ChangePassword replaces the user's password, hashed the same way as in
+// CreateUser, if currentPassword matches. It returns nil when it doesn't.
+// The change signs the user out of every session and uses up any outstanding
+// reset tokens; the returned user carries the new session version.
+func (repository *usersRepository) ChangePassword(userId int, currentPassword string, newPassword string) (*user_models.User, error) {
+	ctx := context.TODO()
+	tx, err := repository.conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(
+		ctx, `UPDATE users SET password = crypt($3, gen_salt('bf', 8)), password_reset_required = false, session_version = session_version + 1
+		WHERE id = $1 AND password = crypt($2, password)
+		RETURNING `+userColumns, userId, currentPassword, newPassword,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error changing password of user %d : %v", userId, err)
+		return nil, err
+	}
+	user, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[user_models.User])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		repository.logger.Sugar().Errorf("Error changing password of user %d : %v", userId, err)
+		return nil, err
+	}
+	if err := invalidatePasswordResets(ctx, tx, userId); err != nil {
+		repository.logger.Sugar().Errorf("Error invalidating password resets of user %d : %v", userId, err)
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	repository.logger.Sugar().Infof("Changed password of user %d", userId)
+	return &user, nil
+}
+
+// RequirePasswordReset signs the user out of every session and keeps them
+// from signing in until they set a new password. It reports false when there
+// is no such user.
+func (repository *usersRepository) RequirePasswordReset(userId int) (bool, error) {
+	tag, err := repository.conn.Exec(
+		context.TODO(), `UPDATE users SET password_reset_required = true, session_version = session_version + 1 WHERE id = $1`, userId,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error requiring password reset of user %d : %v", userId, err)
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// GetSessionState returns the user's current role and the version their
+// session tokens must carry. It returns pgx.ErrNoRows when the user no longer
+// exists.
+func (repository *usersRepository) GetSessionState(userId int) (rbac.Role, int, error) {
+	var role rbac.Role
+	var version int
+	err := repository.conn.QueryRow(
+		context.TODO(), `SELECT role, session_version FROM users WHERE id = $1`, userId,
+	).Scan(&role, &version)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		repository.logger.Sugar().Errorf("Error getting session state of user %d : %v", userId, err)
+	}
+	return role, version, err
+}
@@ -3,7 +3,11 @@ package users
 import (
 	"context"
 	"errors"
+	"strconv"
+	"time"
+
 	user_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
 	"github.com/KylerJacobson/Go-Blog-API/logger"
 	"github.com/jackc/pgx/v5"
 	pgxv5 "github.com/jackc/pgx/v5"
@@ -12,14 +16,28 @@ import (
 
 type UsersRepository interface {
 	CreateUser(user user_models.UserCreate) (string, error)
-	UpdateUser(user user_models.UserUpdate) error
+	UpdateUser(user user_models.UserUpdate) (bool, error)
 	GetUserById(id int) (*user_models.User, error)
 	GetUserByEmail(email string) (*user_models.User, error)
 	GetAllUsers() (*[]user_models.FrontendUser, error)
 	DeleteUserById(id int) error
 	LoginUser(user user_models.UserLogin) (*user_models.User, error)
+	CreatePasswordReset(userId int, tokenHash string, expiresAt time.Time) error
+	ResetPassword(tokenHash string, password string) (bool, error)
+	VerifyEmail(userId int, email string) (bool, error)
+	ListAccessRequests(status string) ([]user_models.AccessRequest, error)
+	DecideAccessRequest(requestId int, approve bool, reason string, decidedBy int) (*user_models.AccessRequest, error)
+	ChangePassword(userId int, currentPassword string, newPassword string) (*user_models.User, error)
+	RequirePasswordReset(userId int) (bool, error)
+	GetSessionState(userId int) (rbac.Role, int, error)
 }
 
+// userColumns are the columns scanned into user_models.User.
+const userColumns = `id, first_name, last_name, email, role, email_notification, email_verified_at IS NOT NULL AS email_verified, password_reset_required, session_version`
+
+// ErrUserNotFound is returned by GetUserByEmail when no user has the address.
+var ErrUserNotFound = errors.New("User not found")
+
 type usersRepository struct {
 	conn   *pgxpool.Pool
 	logger logger.Logger
@@ -36,7 +54,7 @@ func (repository *usersRepository) GetUserById(id int) (*user_models.User, error
 	repository.logger.Sugar().Infof("getting user from the database")
 
 	rows, err := repository.conn.Query(
-		context.TODO(), `SELECT id, first_name, last_name, email, role, email_notification FROM users WHERE id = $1;`, id,
+		context.TODO(), `SELECT `+userColumns+` FROM users WHERE id = $1;`, id,
 	)
 	if err != nil {
 		return nil, err
@@ -69,40 +87,74 @@ func (repository *usersRepository) DeleteUserById(id int) error {
 	return nil
 }
 
+// CreateUser adds the user. A request for privileged access isn't granted
+// here: the user is created with the default role and the request is recorded
+// for an admin to decide.
 func (repository *usersRepository) CreateUser(user user_models.UserCreate) (string, error) {
+	ctx := context.TODO()
+	tx, err := repository.conn.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
 
-	rows, err := repository.conn.Query(context.TODO(), `INSERT INTO users (first_name, last_name, email, password, role, email_notification) VALUES ($1, $2, $3, crypt($4, gen_salt('bf', 8)), $5, $6) RETURNING *`, user.FirstName, user.LastName, user.Email, user.Password, user.AccessRequest, user.EmailNotification)
+	// Every new account starts with the default role, whatever was asked for.
+	rows, err := tx.Query(ctx, `INSERT INTO users (first_name, last_name, email, password, role, email_notification) VALUES ($1, $2, $3, crypt($4, gen_salt('bf', 8)), $5, $6) RETURNING `+userColumns, user.FirstName, user.LastName, user.Email, user.Password, int(rbac.RoleUser), user.EmailNotification)
 	if err != nil {
 		repository.logger.Sugar().Errorf("Error creating user %s %s : %v", user.FirstName, user.FirstName, err)
 		return "", err
 	}
-	defer rows.Close()
 	createdUser, err := pgx.CollectRows(rows, pgx.RowToStructByName[user_models.User])
 	if err != nil {
 		repository.logger.Sugar().Errorf("Error returning user %s %s from database: %v", user.FirstName, user.FirstName, err)
 		return "", err
 	}
 
-	if createdUser[0].Id == "" {
+	if len(createdUser) == 0 || createdUser[0].Id == "" {
 		repository.logger.Sugar().Errorf("Error returning user %s %s from database: %v", user.FirstName, user.FirstName, err)
-		return "", err
+		return "", errors.New("user was not returned after insert")
 	}
 
+	if rbac.Role(user.AccessRequest) == rbac.RolePrivileged {
+		userId, err := strconv.Atoi(createdUser[0].Id)
+		if err != nil {
+			return "", err
+		}
+		_, err = tx.Exec(ctx, `INSERT INTO access_requests (user_id, requested_role) VALUES ($1, $2)`, userId, int(rbac.RolePrivileged))
+		if err != nil {
+			repository.logger.Sugar().Errorf("Error recording access request of user %s : %v", createdUser[0].Id, err)
+			return "", err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", err
+	}
 	return createdUser[0].Id, nil
 }
 
-func (repository *usersRepository) UpdateUser(user user_models.UserUpdate) error {
-	rows, err := repository.conn.Query(context.TODO(), `UPDATE users SET first_name = $1, last_name = $2, email = $3, role = $4, email_notification = $5 WHERE id = $6 `, user.FirstName, user.LastName, user.Email, user.Role, user.EmailNotification, user.Id)
+// UpdateUser saves the user's profile and reports whether their email address
+// changed. A new address isn't verified yet, so it clears email_verified_at.
+func (repository *usersRepository) UpdateUser(user user_models.UserUpdate) (bool, error) {
+	var emailChanged bool
+	err := repository.conn.QueryRow(
+		context.TODO(), `WITH previous AS (SELECT id, email FROM users WHERE id = $6 FOR UPDATE)
+		UPDATE users SET first_name = $1, last_name = $2, email = $3, role = $4, email_notification = $5,
+			email_verified_at = CASE WHEN previous.email = $3 THEN users.email_verified_at END
+		FROM previous WHERE users.id = previous.id
+		RETURNING previous.email <> users.email`,
+		user.FirstName, user.LastName, user.Email, user.Role, user.EmailNotification, user.Id,
+	).Scan(&emailChanged)
 	if err != nil {
-		repository.logger.Sugar().Errorf("Error updating user %s %s : %v", user.FirstName, user.FirstName, err)
-		return err
+		if !errors.Is(err, pgx.ErrNoRows) {
+			repository.logger.Sugar().Errorf("Error updating user %s %s : %v", user.FirstName, user.FirstName, err)
+		}
+		return false, err
 	}
-	defer rows.Close()
-	return nil
+	return emailChanged, nil
 }
 
 func (repository *usersRepository) GetUserByEmail(email string) (*user_models.User, error) {
-	rows, err := repository.conn.Query(context.TODO(), `SELECT id, first_name, last_name, email, role, email_notification FROM users WHERE email = $1`, email)
+	rows, err := repository.conn.Query(context.TODO(), `SELECT `+userColumns+` FROM users WHERE email = $1`, email)
 	if err != nil {
 		repository.logger.Sugar().Errorf("Error retrieving user (%s) from the database: %v", email, err)
 		return nil, err
@@ -114,7 +166,7 @@ func (repository *usersRepository) GetUserByEmail(email string) (*user_models.Us
 	}
 	if len(users) < 1 {
 		repository.logger.Sugar().Errorf("User %s not found: %v", email, err)
-		return nil, errors.New("User not found")
+		return nil, ErrUserNotFound
 	}
 	return &users[0], nil
 }
@@ -144,7 +196,7 @@ func (repository *usersRepository) LoginUser(user user_models.UserLogin) (*user_
 }
 
 func (repository *usersRepository) GetAllUsers() (*[]user_models.FrontendUser, error) {
-	rows, err := repository.conn.Query(context.TODO(), `SELECT id, first_name, last_name, email, role, email_notification, created_at FROM users ORDER BY created_at ASC`)
+	rows, err := repository.conn.Query(context.TODO(), `SELECT id, first_name, last_name, email, role, email_notification, created_at, email_verified_at, password_reset_required FROM users ORDER BY created_at ASC`)
 	if err != nil {
 		repository.logger.Sugar().Errorf("Error retrieving users from the database: %v", err)
 		return nil, err
@@ -156,3 +208,18 @@ func (repository *usersRepository) GetAllUsers() (*[]user_models.FrontendUser, e
 	}
 	return &users, nil
 }
+
+// VerifyEmail marks the user's email address as verified. It reports false
+// when the user no longer exists or has since changed their address to
+// something other than email.
+func (repository *usersRepository) VerifyEmail(userId int, email string) (bool, error) {
+	tag, err := repository.conn.Exec(
+		context.TODO(), `UPDATE users SET email_verified_at = COALESCE(email_verified_at, now()) WHERE id = $1 AND email = $2`,
+		userId, email,
+	)
+	if err != nil {
+		repository.logger.Sugar().Errorf("Error verifying email of user %d : %v", userId, err)
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
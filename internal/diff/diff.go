@@ -0,0 +1,111 @@
+package diff
+
+import "strings"
+
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// Chunk is a run of consecutive lines that were kept, inserted or deleted.
+type Chunk struct {
+	Op    string   `json:"op"`
+	Lines []string `json:"lines"`
+}
+
+// Lines computes a line-based diff turning a into b, using the longest common
+// subsequence of lines. Deletions are reported before insertions.
+func Lines(a, b string) []Chunk {
+	x := splitLines(a)
+	y := splitLines(b)
+
+	var chunks []Chunk
+	add := func(op, line string) {
+		if n := len(chunks); n > 0 && chunks[n-1].Op == op {
+			chunks[n-1].Lines = append(chunks[n-1].Lines, line)
+			return
+		}
+		chunks = append(chunks, Chunk{Op: op, Lines: []string{line}})
+	}
+
+	// Common leading and trailing lines are kept as is, which keeps the LCS table
+	// small for the usual edit that touches a few lines of a long post.
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		add(Equal, x[prefix])
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	trailing := x[len(x)-suffix:]
+	x = x[prefix : len(x)-suffix]
+	y = y[prefix : len(y)-suffix]
+
+	if len(x)*len(y) > maxTableSize {
+		for _, line := range x {
+			add(Delete, line)
+		}
+		for _, line := range y {
+			add(Insert, line)
+		}
+	} else {
+		diffLCS(x, y, add)
+	}
+	for _, line := range trailing {
+		add(Equal, line)
+	}
+	return chunks
+}
+
+// maxTableSize bounds the memory of the LCS table. Larger changes are reported
+// as a deletion of the old lines followed by an insertion of the new ones.
+const maxTableSize = 4_000_000
+
+func diffLCS(x, y []string, add func(op, line string)) {
+	// lcs[i][j] holds the LCS length of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			add(Equal, x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add(Delete, x[i])
+			i++
+		default:
+			add(Insert, y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		add(Delete, x[i])
+	}
+	for ; j < len(y); j++ {
+		add(Insert, y[j])
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+}
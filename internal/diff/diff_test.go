@@ -0,0 +1,57 @@
+package diff
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		a        string
+		b        string
+		expected []Chunk
+	}{
+		{
+			name:     "identical",
+			a:        "one\ntwo",
+			b:        "one\ntwo",
+			expected: []Chunk{{Op: Equal, Lines: []string{"one", "two"}}},
+		},
+		{
+			name: "changed_line",
+			a:    "one\ntwo\nthree",
+			b:    "one\n2\nthree",
+			expected: []Chunk{
+				{Op: Equal, Lines: []string{"one"}},
+				{Op: Delete, Lines: []string{"two"}},
+				{Op: Insert, Lines: []string{"2"}},
+				{Op: Equal, Lines: []string{"three"}},
+			},
+		},
+		{
+			name:     "from_empty",
+			a:        "",
+			b:        "one\ntwo",
+			expected: []Chunk{{Op: Insert, Lines: []string{"one", "two"}}},
+		},
+		{
+			name:     "to_empty",
+			a:        "one",
+			b:        "",
+			expected: []Chunk{{Op: Delete, Lines: []string{"one"}}},
+		},
+		{
+			name:     "both_empty",
+			a:        "",
+			b:        "",
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Lines(tt.a, tt.b))
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package comments
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	comment_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/comments"
+	post_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/posts"
+	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
+	comments_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/comments"
+	posts_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/posts"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+	v5 "github.com/jackc/pgx/v5"
+)
+
+const maxCommentLength = 5000
+
+type CommentsApi interface {
+	ListComments(w http.ResponseWriter, r *http.Request)
+	CreateComment(w http.ResponseWriter, r *http.Request)
+	ListPendingComments(w http.ResponseWriter, r *http.Request)
+	ModerateComment(w http.ResponseWriter, r *http.Request)
+}
+
+type commentsApi struct {
+	commentsRepository comments_repo.CommentsRepository
+	postsRepository    posts_repo.PostsRepository
+	logger             logger.Logger
+}
+
+func New(commentsRepo comments_repo.CommentsRepository, postsRepo posts_repo.PostsRepository, logger logger.Logger) *commentsApi {
+	return &commentsApi{
+		commentsRepository: commentsRepo,
+		postsRepository:    postsRepo,
+		logger:             logger,
+	}
+}
+
+// ListComments returns the approved comments of a post as a tree of replies.
+func (commentsApi *commentsApi) ListComments(w http.ResponseWriter, r *http.Request) {
+	post, err := commentsApi.loadVisiblePost(r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	comments, err := commentsApi.commentsRepository.GetApprovedComments(post.PostId)
+	if err != nil {
+		commentsApi.logger.Sugar().Errorf("error getting comments for post %d : %v", post.PostId, err)
+		httperr.Write(w, httperr.Internal("failed to get comments", ""))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(buildCommentTree(comments))
+}
+
+// CreateComment adds a comment or a reply to a post. New comments wait in the
+// moderation queue until an admin approves them.
+func (commentsApi *commentsApi) CreateComment(w http.ResponseWriter, r *http.Request) {
+	token := session.Manager.GetString(r.Context(), "session_token")
+	claims := authorization.RequestClaims(r.Context(), token)
+	if claims == nil {
+		httperr.Write(w, httperr.New(http.StatusUnauthorized, "Unauthorized", "You must be logged in to comment"))
+		return
+	}
+	post, err := commentsApi.loadVisiblePost(r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	var comment comment_models.CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", err.Error()))
+		return
+	}
+	comment.Content = strings.TrimSpace(comment.Content)
+	if comment.Content == "" || len(comment.Content) > maxCommentLength {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", "comment must be between 1 and 5000 characters"))
+		return
+	}
+	commentId, err := commentsApi.commentsRepository.CreateComment(post.PostId, claims.Sub, comment)
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			httperr.Write(w, httperr.BadRequest("Invalid request body", "parent comment does not belong to this post"))
+			return
+		}
+		commentsApi.logger.Sugar().Errorf("error creating comment on post %d : %v", post.PostId, err)
+		httperr.Write(w, httperr.Internal("failed to create comment", ""))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":     commentId,
+		"status": comment_models.StatusPending,
+	})
+}
+
+func (commentsApi *commentsApi) ListPendingComments(w http.ResponseWriter, r *http.Request) {
+	comments, err := commentsApi.commentsRepository.GetPendingComments()
+	if err != nil {
+		commentsApi.logger.Sugar().Errorf("error getting pending comments : %v", err)
+		httperr.Write(w, httperr.Internal("failed to get pending comments", ""))
+		return
+	}
+	if comments == nil {
+		comments = []comment_models.Comment{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(comments)
+}
+
+// ModerateComment approves or rejects a comment. Only reachable with the comment:moderate permission.
+func (commentsApi *commentsApi) ModerateComment(w http.ResponseWriter, r *http.Request) {
+	commentId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid comment id", "commentId must be an integer"))
+		return
+	}
+	var moderation comment_models.ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&moderation); err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", err.Error()))
+		return
+	}
+	if moderation.Status != comment_models.StatusApproved && moderation.Status != comment_models.StatusRejected && moderation.Status != comment_models.StatusPending {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", "status must be pending, approved or rejected"))
+		return
+	}
+	token := session.Manager.GetString(r.Context(), "session_token")
+	claims := authorization.RequestClaims(r.Context(), token)
+	err = commentsApi.commentsRepository.ModerateComment(commentId, moderation.Status, claims.Sub)
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			httperr.Write(w, httperr.NotFound("Comment not found", ""))
+			return
+		}
+		commentsApi.logger.Sugar().Errorf("error moderating comment %d : %v", commentId, err)
+		httperr.Write(w, httperr.Internal("failed to moderate comment", ""))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadVisiblePost loads the post named by the {id} path value. Unpublished posts
+// take no comments, and comments on restricted posts are only visible to
+// privileged roles.
+func (commentsApi *commentsApi) loadVisiblePost(r *http.Request) (*post_models.Post, error) {
+	postId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return nil, httperr.BadRequest("Invalid post id", "postId must be an integer")
+	}
+	post, err := commentsApi.postsRepository.GetPostById(postId)
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			return nil, httperr.NotFound("Post not found", "")
+		}
+		commentsApi.logger.Sugar().Errorf("error getting post %d : %v", postId, err)
+		return nil, httperr.Internal("failed to get post", "")
+	}
+	if post.Status != post_models.StatusPublished {
+		return nil, httperr.NotFound("Post not found", "")
+	}
+	if post.Restricted {
+		token := session.Manager.GetString(r.Context(), "session_token")
+		if !authorization.CheckPrivilege(r.Context(), token) {
+			return nil, httperr.New(http.StatusForbidden, "Forbidden", "user does not have access to restricted posts")
+		}
+	}
+	return post, nil
+}
+
+// buildCommentTree nests replies under their parents. Replies whose parent
+// isn't in the list, because it is still pending or was rejected, are dropped.
+func buildCommentTree(comments []comment_models.Comment) []*comment_models.Comment {
+	byId := make(map[int]*comment_models.Comment, len(comments))
+	for i := range comments {
+		byId[comments[i].CommentId] = &comments[i]
+	}
+	roots := []*comment_models.Comment{}
+	for i := range comments {
+		comment := &comments[i]
+		if comment.ParentId == nil {
+			roots = append(roots, comment)
+			continue
+		}
+		if parent, ok := byId[*comment.ParentId]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		}
+	}
+	return roots
+}
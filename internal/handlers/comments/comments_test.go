@@ -0,0 +1,33 @@
+package comments
+
+import (
+	"testing"
+
+	comment_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/comments"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildCommentTree(t *testing.T) {
+	parent := func(id int) *int { return &id }
+	comments := []comment_models.Comment{
+		{CommentId: 1},
+		{CommentId: 2, ParentId: parent(1)},
+		{CommentId: 3},
+		{CommentId: 4, ParentId: parent(2)},
+		{CommentId: 5, ParentId: parent(99)},
+	}
+
+	tree := buildCommentTree(comments)
+
+	assert.Len(t, tree, 2)
+	assert.Equal(t, 1, tree[0].CommentId)
+	assert.Equal(t, 3, tree[1].CommentId)
+	assert.Len(t, tree[0].Replies, 1)
+	assert.Equal(t, 2, tree[0].Replies[0].CommentId)
+	assert.Equal(t, 4, tree[0].Replies[0].Replies[0].CommentId)
+	assert.Empty(t, tree[1].Replies)
+}
+
+func TestBuildCommentTreeEmpty(t *testing.T) {
+	assert.Equal(t, []*comment_models.Comment{}, buildCommentTree(nil))
+}
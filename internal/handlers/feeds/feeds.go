@@ -0,0 +1,260 @@
+package feeds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	feed_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/feeds"
+	post_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/posts"
+	posts_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/posts"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/markdown"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+)
+
+// feedSize is the number of most recent posts included in a feed.
+const feedSize = 20
+
+type FeedsApi interface {
+	GetRSSFeed(w http.ResponseWriter, r *http.Request)
+	GetAtomFeed(w http.ResponseWriter, r *http.Request)
+	GetJSONFeed(w http.ResponseWriter, r *http.Request)
+}
+
+// Config describes the blog the feeds are published for. Post links point to
+// SiteURL + "/posts/" + slug.
+type Config struct {
+	SiteURL     string
+	Title       string
+	Description string
+}
+
+type feedsApi struct {
+	postsRepository posts_repo.PostsRepository
+	logger          logger.Logger
+	renderer        *markdown.Renderer
+	config          Config
+}
+
+func New(postsRepo posts_repo.PostsRepository, logger logger.Logger, renderer *markdown.Renderer, config Config) *feedsApi {
+	config.SiteURL = strings.TrimRight(config.SiteURL, "/")
+	return &feedsApi{
+		postsRepository: postsRepo,
+		logger:          logger,
+		renderer:        renderer,
+		config:          config,
+	}
+}
+
+func (feedsApi *feedsApi) GetRSSFeed(w http.ResponseWriter, r *http.Request) {
+	feedsApi.serveFeed(w, r, "rss", "application/rss+xml; charset=utf-8", feedsApi.buildRSS)
+}
+
+func (feedsApi *feedsApi) GetAtomFeed(w http.ResponseWriter, r *http.Request) {
+	feedsApi.serveFeed(w, r, "atom", "application/atom+xml; charset=utf-8", feedsApi.buildAtom)
+}
+
+func (feedsApi *feedsApi) GetJSONFeed(w http.ResponseWriter, r *http.Request) {
+	feedsApi.serveFeed(w, r, "json", "application/feed+json; charset=utf-8", feedsApi.buildJSONFeed)
+}
+
+type feedBuilder func(posts []post_models.Post, feedUrl string, updated time.Time) ([]byte, error)
+
+// serveFeed writes a feed of the most recent public posts, optionally limited to
+// a ?tag=. Only GetRecentPublicPosts is used, so restricted posts never appear.
+// Conditional requests are answered with 304 Not Modified.
+func (feedsApi *feedsApi) serveFeed(w http.ResponseWriter, r *http.Request, format, contentType string, build feedBuilder) {
+	tag := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag")))
+	posts, err := feedsApi.postsRepository.GetRecentPublicPosts(post_models.PostsQuery{Limit: feedSize, Tag: tag})
+	if err != nil {
+		feedsApi.logger.Sugar().Errorf("error getting posts for %s feed : %v", format, err)
+		httperr.Write(w, httperr.Internal("failed to build feed", ""))
+		return
+	}
+
+	lastModified := lastModified(posts)
+	etag := feedETag(format, tag, posts)
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	feedUrl := feedsApi.config.SiteURL + r.URL.RequestURI()
+	for i := range posts {
+		html, err := feedsApi.renderer.Render(posts[i].Content)
+		if err != nil {
+			feedsApi.logger.Sugar().Errorf("error rendering post %d for %s feed : %v", posts[i].PostId, format, err)
+			continue
+		}
+		posts[i].ContentHTML = html
+	}
+	b, err := build(posts, feedUrl, lastModified)
+	if err != nil {
+		feedsApi.logger.Sugar().Errorf("error encoding %s feed : %v", format, err)
+		httperr.Write(w, httperr.Internal("failed to build feed", ""))
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+}
+
+func (feedsApi *feedsApi) buildRSS(posts []post_models.Post, feedUrl string, updated time.Time) ([]byte, error) {
+	rss := feed_models.RSS{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: feed_models.RSSChannel{
+			Title:       feedsApi.config.Title,
+			Link:        feedsApi.config.SiteURL,
+			Description: feedsApi.config.Description,
+			SelfLink:    feed_models.AtomLink{Href: feedUrl, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if !updated.IsZero() {
+		rss.Channel.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, post := range posts {
+		link := feedsApi.postUrl(post)
+		rss.Channel.Items = append(rss.Channel.Items, feed_models.RSSItem{
+			Title:       post.Title,
+			Link:        link,
+			Guid:        feed_models.RSSGuid{IsPermaLink: false, Value: feedsApi.postId(post)},
+			PubDate:     publishedAt(post).UTC().Format(time.RFC1123Z),
+			Description: post.ContentHTML,
+			Categories:  post.Tags,
+		})
+	}
+	return marshalXML(rss)
+}
+
+func (feedsApi *feedsApi) buildAtom(posts []post_models.Post, feedUrl string, updated time.Time) ([]byte, error) {
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+	atom := feed_models.Atom{
+		Title:   feedsApi.config.Title,
+		Id:      feedUrl,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []feed_models.AtomLink{
+			{Href: feedUrl, Rel: "self", Type: "application/atom+xml"},
+			{Href: feedsApi.config.SiteURL, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for _, post := range posts {
+		entry := feed_models.AtomEntry{
+			Title:     post.Title,
+			Id:        feedsApi.postId(post),
+			Link:      feed_models.AtomLink{Href: feedsApi.postUrl(post), Rel: "alternate", Type: "text/html"},
+			Published: publishedAt(post).UTC().Format(time.RFC3339),
+			Updated:   post.UpdatedAt.UTC().Format(time.RFC3339),
+			Content:   feed_models.AtomContent{Type: "html", Value: post.ContentHTML},
+		}
+		for _, tag := range post.Tags {
+			entry.Categories = append(entry.Categories, feed_models.AtomCategory{Term: tag})
+		}
+		atom.Entries = append(atom.Entries, entry)
+	}
+	return marshalXML(atom)
+}
+
+func (feedsApi *feedsApi) buildJSONFeed(posts []post_models.Post, feedUrl string, _ time.Time) ([]byte, error) {
+	feed := feed_models.JSONFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feedsApi.config.Title,
+		HomePageUrl: feedsApi.config.SiteURL,
+		FeedUrl:     feedUrl,
+		Description: feedsApi.config.Description,
+		Items:       []feed_models.JSONFeedItem{},
+	}
+	for _, post := range posts {
+		feed.Items = append(feed.Items, feed_models.JSONFeedItem{
+			Id:            feedsApi.postId(post),
+			Url:           feedsApi.postUrl(post),
+			Title:         post.Title,
+			ContentHtml:   post.ContentHTML,
+			DatePublished: publishedAt(post).UTC().Format(time.RFC3339),
+			DateModified:  post.UpdatedAt.UTC().Format(time.RFC3339),
+			Tags:          post.Tags,
+		})
+	}
+	return json.Marshal(feed)
+}
+
+func (feedsApi *feedsApi) postUrl(post post_models.Post) string {
+	return feedsApi.config.SiteURL + "/posts/" + url.PathEscape(post.Slug)
+}
+
+// postId is a stable identifier for a post that survives slug changes.
+func (feedsApi *feedsApi) postId(post post_models.Post) string {
+	return fmt.Sprintf("%s/posts/%d", feedsApi.config.SiteURL, post.PostId)
+}
+
+func marshalXML(v any) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func publishedAt(post post_models.Post) time.Time {
+	if post.PublishAt != nil {
+		return *post.PublishAt
+	}
+	return post.CreatedAt
+}
+
+// lastModified is the most recent publication or edit among the posts.
+func lastModified(posts []post_models.Post) time.Time {
+	var latest time.Time
+	for _, post := range posts {
+		for _, t := range []time.Time{post.UpdatedAt, publishedAt(post)} {
+			if t.After(latest) {
+				latest = t
+			}
+		}
+	}
+	return latest
+}
+
+// feedETag fingerprints the posts of a feed, so editing, publishing or deleting
+// any of them changes the tag.
+func feedETag(format, tag string, posts []post_models.Post) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s", format, tag)
+	for _, post := range posts {
+		fmt.Fprintf(h, "|%d:%d:%s", post.PostId, post.UpdatedAt.UnixNano(), post.Slug)
+	}
+	return `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+}
+
+// notModified evaluates If-None-Match, falling back to If-Modified-Since when
+// the request carries no entity tags, as RFC 9110 prescribes.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package feeds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotModified(t *testing.T) {
+	lastModified := time.Date(2024, 3, 1, 10, 0, 0, 500, time.UTC)
+	etag := `"abc"`
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected bool
+	}{
+		{name: "unconditional", expected: false},
+		{name: "matching_etag", headers: map[string]string{"If-None-Match": `"xyz", "abc"`}, expected: true},
+		{name: "weak_matching_etag", headers: map[string]string{"If-None-Match": `W/"abc"`}, expected: true},
+		{name: "stale_etag", headers: map[string]string{"If-None-Match": `"xyz"`}, expected: false},
+		{name: "etag_wins_over_date", headers: map[string]string{"If-None-Match": `"xyz"`, "If-Modified-Since": lastModified.Add(time.Hour).Format(http.TimeFormat)}, expected: false},
+		{name: "not_modified_since", headers: map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)}, expected: true},
+		{name: "modified_since", headers: map[string]string{"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)}, expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/feed.rss", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.expected, notModified(r, etag, lastModified))
+		})
+	}
+}
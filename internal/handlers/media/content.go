@@ -0,0 +1,98 @@
+package media
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
+	v5 "github.com/jackc/pgx/v5"
+)
+
+// GetMediaContent streams an attachment through the server. Unlike a signed
+// URL, access to restricted media is checked on every request, so it can be
+// revoked at any time. Range, If-None-Match and If-Modified-Since requests
+// are supported, which lets browsers seek in videos and revalidate caches.
+// Pass download=true to get the file as an attachment.
+func (mediaApi *mediaApi) GetMediaContent(w http.ResponseWriter, r *http.Request) {
+	mediaId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid media id", "id must be an integer"))
+		return
+	}
+	media, err := mediaApi.mediaRepository.GetMediaById(mediaId)
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			httperr.Write(w, httperr.NotFound("Media not found", ""))
+			return
+		}
+		httperr.Write(w, httperr.Internal("failed to get media", ""))
+		return
+	}
+	if media.Restricted && !authorization.CheckPrivilege(r.Context(), session.Manager.GetString(r.Context(), "session_token")) {
+		httperr.Write(w, httperr.New(http.StatusForbidden, "Forbidden", "user does not have access to restricted media"))
+		return
+	}
+
+	info, err := mediaApi.blobStore.Stat(r.Context(), media.BlobName)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			httperr.Write(w, httperr.NotFound("Media not found", "the file is missing from storage"))
+			return
+		}
+		mediaApi.logger.Sugar().Errorf("error getting blob %s : %v", media.BlobName, err)
+		httperr.Write(w, httperr.Internal("failed to read media", ""))
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", media.ContentType)
+	header.Set("Content-Disposition", contentDisposition(media.ContentType, media.OriginalFilename, r.URL.Query().Get("download") == "true"))
+	header.Set("X-Content-Type-Options", "nosniff")
+	// Content-addressed blobs never change, so their hash is a strong ETag.
+	if media.ContentHash != "" {
+		header.Set("ETag", `"`+media.ContentHash+`"`)
+	} else if info.ETag != "" {
+		header.Set("ETag", quoteETag(info.ETag))
+	}
+	if media.Restricted {
+		// Shared caches must not keep it, and browsers must come back to us,
+		// and so through the access check, before reusing their copy.
+		header.Set("Cache-Control", "private, no-cache")
+	} else {
+		header.Set("Cache-Control", "public, max-age=3600")
+	}
+
+	reader := storage.NewBlobReader(r.Context(), mediaApi.blobStore, media.BlobName, info.Size)
+	defer reader.Close()
+	http.ServeContent(w, r, media.OriginalFilename, info.LastModified, reader)
+}
+
+// contentDisposition shows images, audio and video inline and downloads
+// everything else. SVG and HTML could run scripts on our origin, so they are
+// never shown inline.
+func contentDisposition(contentType, filename string, download bool) string {
+	inline := !download &&
+		(strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/") || strings.HasPrefix(contentType, "audio/")) &&
+		!strings.HasPrefix(contentType, "image/svg")
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": filename}); value != "" {
+		return value
+	}
+	return disposition
+}
+
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
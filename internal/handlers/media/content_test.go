@@ -0,0 +1,170 @@
+package media
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	media_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/media"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/local"
+	v5 "github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeMediaRepository struct {
+	media    map[int]media_models.Post
+	uploaded []media_models.NewMedia
+	deleted  []int
+	reserved map[string]int
+}
+
+func (f *fakeMediaRepository) GetMediaByPostId(postId int) ([]media_models.Post, error) {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) ReserveBlob(blobName string) (bool, error) {
+	if f.reserved == nil {
+		f.reserved = map[string]int{}
+	}
+	f.reserved[blobName]++
+	return f.reserved[blobName] > 1, nil
+}
+
+func (f *fakeMediaRepository) ReleaseBlob(blobName string) error {
+	f.reserved[blobName]--
+	return nil
+}
+
+func (f *fakeMediaRepository) UploadMedia(media media_models.NewMedia) (int, error) {
+	f.reserved[media.BlobName]--
+	f.uploaded = append(f.uploaded, media)
+	return len(f.uploaded), nil
+}
+
+func (f *fakeMediaRepository) DeleteMedia(mediaId int) (*media_models.Post, []string, error) {
+	media, ok := f.media[mediaId]
+	if !ok {
+		return nil, nil, nil
+	}
+	delete(f.media, mediaId)
+	f.deleted = append(f.deleted, mediaId)
+	return &media, nil, nil
+}
+
+func (f *fakeMediaRepository) GetMediaById(mediaId int) (*media_models.Post, error) {
+	media, ok := f.media[mediaId]
+	if !ok {
+		return nil, v5.ErrNoRows
+	}
+	return &media, nil
+}
+
+func (f *fakeMediaRepository) ListMedia(query media_models.MediaQuery) ([]media_models.Post, error) {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) DeleteMediaWithoutPost() (int64, error) {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) ReleaseUnreferencedBlobs(staleBefore time.Time) ([]string, error) {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) KnownBlobs(blobNames []string) (map[string]bool, error) {
+	panic("implement me")
+}
+
+func TestGetMediaContent(t *testing.T) {
+	session.Init()
+	store, err := local.NewLocalStore(t.TempDir(), "http://localhost", []byte("key"), zap.NewNop())
+	assert.NoError(t, err)
+	assert.NoError(t, store.Upload(context.Background(), "blog-media/abc", strings.NewReader("0123456789"), "video/mp4"))
+
+	repo := &fakeMediaRepository{media: map[int]media_models.Post{
+		1: {MediaId: 1, BlobName: "blog-media/abc", ContentHash: "abc", ContentType: "video/mp4", OriginalFilename: "clip.mp4"},
+		2: {MediaId: 2, BlobName: "blog-media/abc", ContentHash: "abc", ContentType: "video/mp4", OriginalFilename: "clip.mp4", Restricted: true},
+		3: {MediaId: 3, BlobName: "blog-media/missing", ContentType: "text/html", OriginalFilename: "page.html"},
+	}}
+	api := New(repo, nil, zap.NewNop(), store, Config{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/media/{id}/content", api.GetMediaContent)
+	handler := session.Manager.LoadAndSave(mux)
+
+	tests := []struct {
+		name           string
+		url            string
+		headers        map[string]string
+		expectedStatus int
+		expectedBody   string
+		expectedHeader map[string]string
+	}{
+		{
+			name:           "full content",
+			url:            "/api/media/1/content",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "0123456789",
+			expectedHeader: map[string]string{
+				"Content-Type":        "video/mp4",
+				"Content-Disposition": `inline; filename=clip.mp4`,
+				"ETag":                `"abc"`,
+				"Accept-Ranges":       "bytes",
+			},
+		},
+		{
+			name:           "range",
+			url:            "/api/media/1/content",
+			headers:        map[string]string{"Range": "bytes=2-5"},
+			expectedStatus: http.StatusPartialContent,
+			expectedBody:   "2345",
+			expectedHeader: map[string]string{"Content-Range": "bytes 2-5/10"},
+		},
+		{
+			name:           "not modified",
+			url:            "/api/media/1/content",
+			headers:        map[string]string{"If-None-Match": `"abc"`},
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			name:           "download",
+			url:            "/api/media/1/content?download=true",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "0123456789",
+			expectedHeader: map[string]string{"Content-Disposition": `attachment; filename=clip.mp4`},
+		},
+		{name: "restricted without a session", url: "/api/media/2/content", expectedStatus: http.StatusForbidden},
+		{name: "blob missing from storage", url: "/api/media/3/content", expectedStatus: http.StatusNotFound},
+		{name: "unknown media", url: "/api/media/9/content", expectedStatus: http.StatusNotFound},
+		{name: "bad id", url: "/api/media/abc/content", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+			for key, value := range tt.expectedHeader {
+				assert.Equal(t, value, rr.Header().Get(key), key)
+			}
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	assert.Equal(t, "inline; filename=photo.png", contentDisposition("image/png", "photo.png", false))
+	assert.Equal(t, "attachment; filename=drawing.svg", contentDisposition("image/svg+xml", "drawing.svg", false))
+	assert.Equal(t, "attachment; filename=page.html", contentDisposition("text/html", "page.html", false))
+	assert.Equal(t, "attachment; filename*=utf-8''caf%C3%A9.jpg", contentDisposition("image/jpeg", "café.jpg", true))
+}
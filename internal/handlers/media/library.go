@@ -0,0 +1,144 @@
+package media
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	media_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/media"
+	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
+	v5 "github.com/jackc/pgx/v5"
+)
+
+const (
+	defaultLibraryPageSize = 50
+	maxLibraryPageSize     = 200
+)
+
+// DeleteMedia removes an attachment. Only the author of the post it belongs to
+// or an admin may delete it. The blob is deleted from storage once no other
+// post uses it.
+func (mediaApi *mediaApi) DeleteMedia(w http.ResponseWriter, r *http.Request) {
+	mediaId, err := strconv.Atoi(r.PathValue("mediaId"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid media id", "mediaId must be an integer"))
+		return
+	}
+	media, err := mediaApi.mediaRepository.GetMediaById(mediaId)
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			httperr.Write(w, httperr.NotFound("Media not found", ""))
+			return
+		}
+		httperr.Write(w, httperr.Internal("failed to get media", ""))
+		return
+	}
+
+	// Media whose post is already gone has no author, so only users allowed to delete any post may remove it.
+	authorId := 0
+	post, err := mediaApi.postsRepository.GetPostById(media.PostId)
+	if err == nil {
+		authorId = post.UserId
+	} else if !errors.Is(err, v5.ErrNoRows) {
+		mediaApi.logger.Sugar().Errorf("error getting post %d : %v", media.PostId, err)
+		httperr.Write(w, httperr.Internal("failed to get post", ""))
+		return
+	}
+	claims := authorization.RequestClaims(r.Context(), session.Manager.GetString(r.Context(), "session_token"))
+	if err := authorization.CanDeletePost(claims, authorId); err != nil {
+		httperr.Write(w, err)
+		return
+	}
+
+	deleted, orphaned, err := mediaApi.mediaRepository.DeleteMedia(mediaId)
+	if err != nil {
+		httperr.Write(w, httperr.Internal("failed to delete media", ""))
+		return
+	}
+	if deleted == nil {
+		httperr.Write(w, httperr.NotFound("Media not found", ""))
+		return
+	}
+	// A blob that fails to delete here is no longer referenced, so the
+	// reconciler removes it later.
+	if err := storage.DeleteAll(r.Context(), mediaApi.blobStore, orphaned); err != nil {
+		mediaApi.logger.Sugar().Errorf("error deleting blobs of media %d : %v", mediaId, err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListMedia serves the admin media library, newest first. It accepts limit and
+// offset for paging and postId, contentType and restricted as filters.
+func (mediaApi *mediaApi) ListMedia(w http.ResponseWriter, r *http.Request) {
+	query, err := parseMediaQuery(r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	media, err := mediaApi.mediaRepository.ListMedia(query)
+	if err != nil {
+		httperr.Write(w, httperr.Internal("failed to list media", ""))
+		return
+	}
+
+	page := media_models.MediaPage{Media: media}
+	if page.Media == nil {
+		page.Media = []media_models.Post{}
+	}
+	if len(media) >= query.Limit {
+		page.Media = media[:query.Limit-1]
+		next := query.Offset + len(page.Media)
+		page.NextOffset = &next
+	}
+	for i := range page.Media {
+		page.Media[i].Url, err = mediaApi.blobStore.SignedURL(r.Context(), page.Media[i].BlobName, mediaApi.urlTTL(page.Media[i].Restricted))
+		if err != nil {
+			mediaApi.logger.Sugar().Errorf("error getting URL for blob %s : %v", page.Media[i].BlobName, err)
+			httperr.Write(w, httperr.Internal("failed to get media URLs", ""))
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
+// parseMediaQuery reads the library filters. Like the posts pages it asks for
+// one extra row to tell whether there is a next page.
+func parseMediaQuery(r *http.Request) (media_models.MediaQuery, error) {
+	values := r.URL.Query()
+	query := media_models.MediaQuery{Limit: defaultLibraryPageSize + 1, ContentType: values.Get("contentType")}
+	if l := values.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			return query, httperr.BadRequest("Invalid limit", "limit must be a positive integer")
+		}
+		query.Limit = min(limit, maxLibraryPageSize) + 1
+	}
+	if o := values.Get("offset"); o != "" {
+		offset, err := strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			return query, httperr.BadRequest("Invalid offset", "offset must be a non-negative integer")
+		}
+		query.Offset = offset
+	}
+	if p := values.Get("postId"); p != "" {
+		postId, err := strconv.Atoi(p)
+		if err != nil {
+			return query, httperr.BadRequest("Invalid postId", "postId must be an integer")
+		}
+		query.PostId = &postId
+	}
+	if rs := values.Get("restricted"); rs != "" {
+		restricted, err := strconv.ParseBool(rs)
+		if err != nil {
+			return query, httperr.BadRequest("Invalid restricted", "restricted must be a boolean")
+		}
+		query.Restricted = &restricted
+	}
+	return query, nil
+}
@@ -0,0 +1,43 @@
+package media
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	media_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/media"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMediaQuery(t *testing.T) {
+	postId := 7
+	restricted := true
+	tests := []struct {
+		name      string
+		url       string
+		expected  media_models.MediaQuery
+		expectErr bool
+	}{
+		{name: "defaults", url: "/api/media", expected: media_models.MediaQuery{Limit: defaultLibraryPageSize + 1}},
+		{
+			name:     "filters",
+			url:      "/api/media?limit=10&offset=20&postId=7&contentType=image/&restricted=true",
+			expected: media_models.MediaQuery{Limit: 11, Offset: 20, PostId: &postId, ContentType: "image/", Restricted: &restricted},
+		},
+		{name: "limit is capped", url: "/api/media?limit=5000", expected: media_models.MediaQuery{Limit: maxLibraryPageSize + 1}},
+		{name: "bad limit", url: "/api/media?limit=0", expectErr: true},
+		{name: "bad offset", url: "/api/media?offset=-1", expectErr: true},
+		{name: "bad postId", url: "/api/media?postId=abc", expectErr: true},
+		{name: "bad restricted", url: "/api/media?restricted=maybe", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := parseMediaQuery(httptest.NewRequest("GET", tt.url, nil))
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, query)
+		})
+	}
+}
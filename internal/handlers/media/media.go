@@ -2,35 +2,62 @@ package media
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
 	media_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/media"
+	posts_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/posts"
 	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
-	"github.com/KylerJacobson/Go-Blog-API/internal/services/azure"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
 	"github.com/KylerJacobson/Go-Blog-API/logger"
+	v5 "github.com/jackc/pgx/v5"
 )
 
 type MediaApi interface {
 	GetMediaByPostId(w http.ResponseWriter, r *http.Request)
 	UploadMedia(w http.ResponseWriter, r *http.Request)
+	DeleteMedia(w http.ResponseWriter, r *http.Request)
+	ListMedia(w http.ResponseWriter, r *http.Request)
+	GetMediaContent(w http.ResponseWriter, r *http.Request)
+}
+
+// Config holds the media settings that come from the environment.
+type Config struct {
+	// VariantWidths are the widths, in pixels, that uploaded images are
+	// resized to. Widths at or above an image's own width are skipped.
+	VariantWidths []int
+	// URLTTL is how long signed URLs for public media stay valid, and
+	// RestrictedURLTTL the same for restricted media. Keep the latter short, as
+	// a leaked URL grants access until it expires.
+	URLTTL           time.Duration
+	RestrictedURLTTL time.Duration
+	// UploadPolicy decides which file types each role may upload.
+	UploadPolicy UploadPolicy
 }
 
 type mediaApi struct {
 	mediaRepository media_repo.MediaRepository
+	postsRepository posts_repo.PostsRepository
 	logger          logger.Logger
-	azClient        *azure.AzureClient
+	blobStore       storage.BlobStore
+	config          Config
 }
 
-func New(mediaRepo media_repo.MediaRepository, logger logger.Logger, client *azure.AzureClient) *mediaApi {
+func New(mediaRepo media_repo.MediaRepository, postsRepo posts_repo.PostsRepository, logger logger.Logger, blobStore storage.BlobStore, config Config) *mediaApi {
 	return &mediaApi{
 		mediaRepository: mediaRepo,
+		postsRepository: postsRepo,
 		logger:          logger,
-		azClient:        client,
+		blobStore:       blobStore,
+		config:          config,
 	}
 }
 
@@ -44,7 +71,7 @@ func (mediaApi *mediaApi) GetMediaByPostId(w http.ResponseWriter, r *http.Reques
 	}
 
 	token := session.Manager.GetString(r.Context(), "session_token")
-	privilege := authorization.CheckPrivilege(token)
+	privilege := authorization.CheckPrivilege(r.Context(), token)
 
 	media, err := mediaApi.mediaRepository.GetMediaByPostId(postId)
 	if err != nil {
@@ -57,25 +84,46 @@ func (mediaApi *mediaApi) GetMediaByPostId(w http.ResponseWriter, r *http.Reques
 
 	// TODO create object with post + urls
 	type postMedia struct {
+		MediaId     int    `json:"media_id"`
 		Url         string `json:"url"`
 		ContentType string `json:"content_type"`
+		Filename    string `json:"filename"`
+		Width       int    `json:"width,omitempty"`
+		Height      int    `json:"height,omitempty"`
+		// Srcset lists the resized variants, narrowest first.
+		Srcset []srcsetEntry `json:"srcset"`
 	}
 	var postMediaSlc = []postMedia{}
 	for _, attachment := range media {
-		//Check auth status
-		url, err := mediaApi.azClient.GetUrlForBlob(attachment.BlobName)
-		if err != nil {
-			mediaApi.logger.Sugar().Errorf("error getting URL for blob: %v", err)
-			http.Error(w, "postId must be an integer", http.StatusInternalServerError)
-			return
-		}
-		postMediaSlc = append(postMediaSlc, postMedia{Url: url, ContentType: attachment.ContentType})
+		// Check access before signing so no restricted URL is issued for a
+		// request that will be refused.
 		if attachment.Restricted {
 			if !privilege {
 				http.Error(w, "user does not have access to restricted posts", http.StatusForbidden)
 				return
 			}
 		}
+		url, err := mediaApi.blobStore.SignedURL(r.Context(), attachment.BlobName, mediaApi.urlTTL(attachment.Restricted))
+		if err != nil {
+			mediaApi.logger.Sugar().Errorf("error getting URL for blob: %v", err)
+			http.Error(w, "postId must be an integer", http.StatusInternalServerError)
+			return
+		}
+		srcset, err := mediaApi.srcset(r, attachment.Variants, attachment.Restricted)
+		if err != nil {
+			mediaApi.logger.Sugar().Errorf("error getting URL for variant: %v", err)
+			http.Error(w, "error getting media URLs", http.StatusInternalServerError)
+			return
+		}
+		postMediaSlc = append(postMediaSlc, postMedia{
+			MediaId:     attachment.MediaId,
+			Url:         url,
+			ContentType: attachment.ContentType,
+			Filename:    attachment.OriginalFilename,
+			Width:       attachment.Width,
+			Height:      attachment.Height,
+			Srcset:      srcset,
+		})
 	}
 	b, err := json.Marshal(postMediaSlc)
 	if err != nil {
@@ -89,23 +137,36 @@ func (mediaApi *mediaApi) GetMediaByPostId(w http.ResponseWriter, r *http.Reques
 	w.Write(b)
 }
 
+func (mediaApi *mediaApi) urlTTL(restricted bool) time.Duration {
+	if restricted {
+		return mediaApi.config.RestrictedURLTTL
+	}
+	return mediaApi.config.URLTTL
+}
+
 func (mediaApi *mediaApi) UploadMedia(w http.ResponseWriter, r *http.Request) {
+	claims := authorization.RequestClaims(r.Context(), session.Manager.GetString(r.Context(), "session_token"))
 
-	// Limit the size of the incoming request to 10 MB
-	r.Body = http.MaxBytesReader(w, r.Body, 10<<20) // 10 MB
+	// Limit the request to the largest file the caller may upload. Each file
+	// is checked against its own type's limit once the form is parsed.
+	maxSize := mediaApi.config.UploadPolicy.MaxSize(roleOf(claims))
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
 
-	// Parse the multipart form data
-	err := r.ParseMultipartForm(10 << 20) // 10 MB
+	// Parse the multipart form data; files over 10 MB are kept on disk.
+	err := r.ParseMultipartForm(10 << 20)
 	if err != nil {
-		http.Error(w, "Error parsing form data: "+err.Error(), http.StatusBadRequest)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			httperr.Write(w, httperr.TooLarge("Upload too large", fmt.Sprintf("uploads are limited to %d bytes", maxSize)))
+			return
+		}
+		httperr.Write(w, httperr.BadRequest("Error parsing form data", err.Error()))
 		return
 	}
 
 	// Retrieve the files from the "files" form field
 	restricted := r.Form.Get("restricted")
 	postId := r.Form.Get("postId")
-	fmt.Println(restricted)
-	fmt.Println(postId)
 	iPostId, err := strconv.Atoi(postId)
 	if err != nil {
 		mediaApi.logger.Sugar().Errorf("postId parameter was not an integer: %v", err)
@@ -115,7 +176,36 @@ func (mediaApi *mediaApi) UploadMedia(w http.ResponseWriter, r *http.Request) {
 	bRestricted, err := strconv.ParseBool(restricted)
 	if err != nil {
 		mediaApi.logger.Sugar().Errorf("restricted parameter was not a boolean: %v", err)
-		http.Error(w, "postId must be an integer", http.StatusBadRequest)
+		http.Error(w, "restricted must be a boolean", http.StatusBadRequest)
+		return
+	}
+	keepMetadata := false
+	if value := r.Form.Get("keepMetadata"); value != "" {
+		keepMetadata, err = strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "keepMetadata must be a boolean", http.StatusBadRequest)
+			return
+		}
+	}
+	// Photos are stripped of location and device metadata unless a user with
+	// the keep-metadata permission explicitly asks to keep it.
+	if keepMetadata {
+		if !authorization.HasPermission(claims, rbac.MediaKeepMetadata) {
+			http.Error(w, "you are not allowed to keep photo metadata", http.StatusForbidden)
+			return
+		}
+	}
+	post, err := mediaApi.postsRepository.GetPostById(iPostId)
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			httperr.Write(w, httperr.NotFound("Post not found", ""))
+			return
+		}
+		httperr.Write(w, httperr.Internal("failed to get post", ""))
+		return
+	}
+	if err := authorization.CanModifyPost(claims, post.UserId); err != nil {
+		httperr.Write(w, err)
 		return
 	}
 	files := r.MultipartForm.File["photos"]
@@ -123,30 +213,54 @@ func (mediaApi *mediaApi) UploadMedia(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "No files uploaded", http.StatusBadRequest)
 		return
 	}
-	if err != nil {
-		mediaApi.logger.Sugar().Errorf("Error creating the azure blob client: %v", err)
-		// return 500 error
-	}
-	for _, fileHeader := range files {
-		// Process each file
-		blobName := "blog-media/" + fileHeader.Filename
-		err := mediaApi.azClient.UploadFileToBlob(fileHeader, blobName)
-		if err != nil {
-			mediaApi.logger.Sugar().Errorf("Error uploading media: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			b, _ := json.Marshal(err)
-			w.Write(b)
-			return
-		}
-		fileType, err := getFileContentType(fileHeader)
+	// Check every file before storing any, so a rejected batch leaves nothing
+	// behind.
+	fileTypes := make([]string, len(files))
+	var rejected []*httperr.Error
+	for i, fileHeader := range files {
+		fileTypes[i], err = getFileContentType(fileHeader)
 		if err != nil {
 			mediaApi.logger.Sugar().Errorf("error getting the mime type of the file: %v", err)
-			http.Error(w, "postId must be an integer", http.StatusInternalServerError)
+			httperr.Write(w, httperr.Internal("failed to read uploaded file", ""))
 			return
 		}
-		err = mediaApi.mediaRepository.UploadMedia(iPostId, blobName, fileType, bRestricted)
+		if err := mediaApi.config.UploadPolicy.Check(roleOf(claims), fileHeader.Filename, fileTypes[i], fileHeader.Size); err != nil {
+			rejected = append(rejected, err)
+		}
+	}
+	if len(rejected) > 0 {
+		httperr.Write(w, httperr.Batch(fmt.Sprintf("%d of %d files were rejected", len(rejected), len(files)), rejected))
+		return
+	}
+	for i, fileHeader := range files {
+		upload := mediaUpload{
+			PostId:       iPostId,
+			Filename:     fileHeader.Filename,
+			ContentType:  fileTypes[i],
+			Restricted:   bRestricted,
+			KeepMetadata: keepMetadata,
+		}
+		if fileHeader.Size <= maxInMemoryUpload {
+			var data []byte
+			data, err = readFile(fileHeader)
+			if err != nil {
+				mediaApi.logger.Sugar().Errorf("error reading the file: %v", err)
+				httperr.Write(w, httperr.Internal("failed to read uploaded file", ""))
+				return
+			}
+			_, err = mediaApi.storeMedia(r.Context(), data, upload)
+		} else {
+			_, err = mediaApi.storeMediaStream(r.Context(), func() (io.ReadCloser, error) {
+				return fileHeader.Open()
+			}, upload)
+		}
 		if err != nil {
-			mediaApi.logger.Sugar().Errorf("Error uploading media reference to database: %v", err)
+			var httpErr *httperr.Error
+			if errors.As(err, &httpErr) {
+				httperr.Write(w, err)
+				return
+			}
+			mediaApi.logger.Sugar().Errorf("Error uploading media: %v", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			b, _ := json.Marshal(err)
 			w.Write(b)
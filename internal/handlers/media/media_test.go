@@ -0,0 +1,202 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	media_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/media"
+	post_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/posts"
+	posts_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/posts"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/local"
+	"github.com/golang-jwt/jwt/v5"
+	v5 "github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakePostsRepository struct {
+	posts_repo.PostsRepository
+	posts map[int]post_models.Post
+}
+
+func (f *fakePostsRepository) GetPostById(postId int) (*post_models.Post, error) {
+	post, ok := f.posts[postId]
+	if !ok {
+		return nil, v5.ErrNoRows
+	}
+	return &post, nil
+}
+
+func TestUploadMediaPostAccess(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	store, err := local.NewLocalStore(t.TempDir(), "http://localhost", []byte("key"), zap.NewNop())
+	assert.NoError(t, err)
+	var photo bytes.Buffer
+	assert.NoError(t, png.Encode(&photo, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+
+	tests := []struct {
+		name           string
+		user           int
+		postId         string
+		expectedStatus int
+	}{
+		{name: "author", user: 7, postId: "1", expectedStatus: http.StatusOK},
+		{name: "someone else's post", user: 8, postId: "1", expectedStatus: http.StatusForbidden},
+		{name: "missing post", user: 7, postId: "2", expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaRepo := &fakeMediaRepository{}
+			postsRepo := &fakePostsRepository{posts: map[int]post_models.Post{1: {PostId: 1, UserId: 7}}}
+			api := New(mediaRepo, postsRepo, zap.NewNop(), store, Config{UploadPolicy: DefaultUploadPolicy()})
+
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			form.WriteField("postId", tt.postId)
+			form.WriteField("restricted", "false")
+			part, _ := form.CreateFormFile("photos", "photo.png")
+			part.Write(photo.Bytes())
+			form.Close()
+			req := httptest.NewRequest(http.MethodPost, "/api/media", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": tt.user, "role": 0, "exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte("secret"))
+			assert.NoError(t, err)
+			rr := httptest.NewRecorder()
+			session.Manager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				session.Manager.Put(r.Context(), "session_token", token)
+				api.UploadMedia(w, r)
+			})).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Len(t, mediaRepo.uploaded, 1)
+			} else {
+				assert.Empty(t, mediaRepo.uploaded)
+			}
+		})
+	}
+}
+
+func TestDeleteMediaAccess(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	rbac.SetCustomRoles([]rbac.Definition{
+		{Id: 3, Name: "editor", Permissions: []rbac.Permission{rbac.PostUpdateAny}},
+		{Id: 4, Name: "janitor", Permissions: []rbac.Permission{rbac.PostDeleteAny}},
+	})
+	defer rbac.SetCustomRoles(nil)
+
+	tests := []struct {
+		name           string
+		user           int
+		role           int
+		expectedStatus int
+	}{
+		{name: "author", user: 7, role: 0, expectedStatus: http.StatusNoContent},
+		{name: "someone else", user: 8, role: 0, expectedStatus: http.StatusForbidden},
+		{name: "may update but not delete any post", user: 8, role: 3, expectedStatus: http.StatusForbidden},
+		{name: "may delete any post", user: 8, role: 4, expectedStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaRepo := &fakeMediaRepository{media: map[int]media_models.Post{1: {MediaId: 1, PostId: 1, BlobName: "blog-media/abc"}}}
+			postsRepo := &fakePostsRepository{posts: map[int]post_models.Post{1: {PostId: 1, UserId: 7}}}
+			store, err := local.NewLocalStore(t.TempDir(), "http://localhost", []byte("key"), zap.NewNop())
+			assert.NoError(t, err)
+			api := New(mediaRepo, postsRepo, zap.NewNop(), store, Config{})
+			mux := http.NewServeMux()
+			mux.HandleFunc("DELETE /api/media/{mediaId}", api.DeleteMedia)
+
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": tt.user, "role": tt.role, "exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte("secret"))
+			assert.NoError(t, err)
+			rr := httptest.NewRecorder()
+			session.Manager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				session.Manager.Put(r.Context(), "session_token", token)
+				mux.ServeHTTP(w, r)
+			})).ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/api/media/1", nil))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusNoContent {
+				assert.Equal(t, []int{1}, mediaRepo.deleted)
+			} else {
+				assert.Empty(t, mediaRepo.deleted)
+			}
+		})
+	}
+}
+
+func TestRegisterMediaReservation(t *testing.T) {
+	mediaRepo := &fakeMediaRepository{}
+	api := New(mediaRepo, nil, zap.NewNop(), nil, Config{})
+	newMedia := media_models.NewMedia{PostId: 1, BlobName: "blog-media/abc"}
+
+	_, err := api.registerMedia(newMedia, func(newMedia *media_models.NewMedia, referenced bool) error {
+		assert.Equal(t, 1, mediaRepo.reserved["blog-media/abc"], "reserved while storing")
+		return errors.New("storage unavailable")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, mediaRepo.reserved["blog-media/abc"], "released when storing fails")
+	assert.Empty(t, mediaRepo.uploaded)
+
+	_, err = api.registerMedia(newMedia, func(newMedia *media_models.NewMedia, referenced bool) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, mediaRepo.reserved["blog-media/abc"], "turned into a reference once recorded")
+	assert.Len(t, mediaRepo.uploaded, 1)
+}
+
+func TestUploadMediaSizeLimit(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	store, err := local.NewLocalStore(t.TempDir(), "http://localhost", []byte("key"), zap.NewNop())
+	assert.NoError(t, err)
+	policy := UploadPolicy{rbac.RoleUser: {{ContentType: "application/pdf", Extensions: []string{".pdf"}, MaxSize: 12 * mb}}}
+
+	tests := []struct {
+		name           string
+		size           int
+		expectedStatus int
+	}{
+		{name: "over the old 10 MB cap", size: 11 * mb, expectedStatus: http.StatusOK},
+		{name: "over the policy", size: 20 * mb, expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mediaRepo := &fakeMediaRepository{}
+			postsRepo := &fakePostsRepository{posts: map[int]post_models.Post{1: {PostId: 1, UserId: 7}}}
+			api := New(mediaRepo, postsRepo, zap.NewNop(), store, Config{UploadPolicy: policy})
+
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			form.WriteField("postId", "1")
+			form.WriteField("restricted", "false")
+			part, _ := form.CreateFormFile("photos", "paper.pdf")
+			part.Write(append([]byte("%PDF-1.4\n"), make([]byte, tt.size)...))
+			form.Close()
+			req := httptest.NewRequest(http.MethodPost, "/api/media", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": 7, "role": 0, "exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte("secret"))
+			assert.NoError(t, err)
+			rr := httptest.NewRecorder()
+			session.Manager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				session.Manager.Put(r.Context(), "session_token", token)
+				api.UploadMedia(w, r)
+			})).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code, rr.Body.String())
+		})
+	}
+}
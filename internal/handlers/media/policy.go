@@ -0,0 +1,155 @@
+package media
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+)
+
+// AllowedType is a file type a role may upload.
+type AllowedType struct {
+	// ContentType is compared against the type sniffed from the file's
+	// content, not the one the client declares.
+	ContentType string `json:"contentType"`
+	// Extensions lists the file name extensions, with the leading dot, that
+	// this type may be uploaded under.
+	Extensions []string `json:"extensions"`
+	MaxSize    int64    `json:"maxSize"`
+}
+
+// UploadPolicy lists, per role, the file types that may be uploaded. Roles
+// without an entry, such as custom roles, use the rules of rbac.RoleUser.
+// Whether a role may upload at all is decided by the media:upload permission.
+type UploadPolicy map[rbac.Role][]AllowedType
+
+const mb = 1 << 20
+
+// multipartOverhead is allowed on top of the file sizes for the boundaries,
+// headers and other fields of a multipart upload.
+const multipartOverhead = 1 * mb
+
+// DefaultUploadPolicy allows everyone images, and admins and privileged users
+// video, audio and PDFs as well.
+func DefaultUploadPolicy() UploadPolicy {
+	images := []AllowedType{
+		{ContentType: "image/jpeg", Extensions: []string{".jpg", ".jpeg"}, MaxSize: 10 * mb},
+		{ContentType: "image/png", Extensions: []string{".png"}, MaxSize: 10 * mb},
+		{ContentType: "image/webp", Extensions: []string{".webp"}, MaxSize: 10 * mb},
+		{ContentType: "image/gif", Extensions: []string{".gif"}, MaxSize: 10 * mb},
+	}
+	extended := append([]AllowedType{
+		{ContentType: "video/mp4", Extensions: []string{".mp4", ".m4v"}, MaxSize: 2048 * mb},
+		{ContentType: "video/webm", Extensions: []string{".webm"}, MaxSize: 2048 * mb},
+		{ContentType: "audio/mpeg", Extensions: []string{".mp3"}, MaxSize: 100 * mb},
+		{ContentType: "application/pdf", Extensions: []string{".pdf"}, MaxSize: 20 * mb},
+	}, images...)
+	return UploadPolicy{rbac.RoleUser: images, rbac.RoleAdmin: extended, rbac.RolePrivileged: extended}
+}
+
+// ParseUploadPolicy reads a policy from JSON keyed by role, for example
+// {"0": [{"contentType": "image/png", "extensions": [".png"], "maxSize": 1048576}]}.
+func ParseUploadPolicy(data []byte) (UploadPolicy, error) {
+	var raw map[string][]AllowedType
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	policy := UploadPolicy{}
+	for key, types := range raw {
+		role, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("role %q is not an integer", key)
+		}
+		for i, allowed := range types {
+			if allowed.ContentType == "" || len(allowed.Extensions) == 0 || allowed.MaxSize <= 0 {
+				return nil, fmt.Errorf("role %d: entry %d needs a contentType, extensions and a positive maxSize", role, i)
+			}
+			for j, ext := range allowed.Extensions {
+				types[i].Extensions[j] = strings.ToLower(ext)
+			}
+		}
+		policy[rbac.Role(role)] = types
+	}
+	return policy, nil
+}
+
+func roleOf(claims *authorization.UserClaim) rbac.Role {
+	if claims == nil {
+		return rbac.RoleUser
+	}
+	return claims.Role
+}
+
+// rules returns the file types role may upload.
+func (policy UploadPolicy) rules(role rbac.Role) []AllowedType {
+	if types, ok := policy[role]; ok {
+		return types
+	}
+	return policy[rbac.RoleUser]
+}
+
+// MaxSize is the size of the largest file role may upload.
+func (policy UploadPolicy) MaxSize(role rbac.Role) int64 {
+	var maxSize int64
+	for _, allowed := range policy.rules(role) {
+		maxSize = max(maxSize, allowed.MaxSize)
+	}
+	return maxSize
+}
+
+// Check validates a whole file against the rules of role. contentType is the
+// type sniffed from the content. A type that isn't allowed, or doesn't match
+// the file's extension, is refused with a 415 and a file over the size limit
+// with a 413.
+func (policy UploadPolicy) Check(role rbac.Role, filename, contentType string, size int64) *httperr.Error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	var allowed *AllowedType
+	types := policy.rules(role)
+	for i, candidate := range types {
+		if candidate.ContentType == mediaType {
+			allowed = &types[i]
+			break
+		}
+	}
+	if allowed == nil {
+		return httperr.UnsupportedMediaType("Unsupported file type", fmt.Sprintf("%s: %s files can't be uploaded", filename, mediaType))
+	}
+	ext := strings.ToLower(filepath.Ext(filename))
+	if !slices.Contains(allowed.Extensions, ext) {
+		return httperr.UnsupportedMediaType("File type doesn't match its name", fmt.Sprintf("%s: the content is %s, which should be named %s", filename, mediaType, strings.Join(allowed.Extensions, " or ")))
+	}
+	if size > allowed.MaxSize {
+		return httperr.TooLarge("File too large", fmt.Sprintf("%s: %s files are limited to %d bytes", filename, mediaType, allowed.MaxSize))
+	}
+	return nil
+}
+
+// CheckDeclared is Check for a file whose content hasn't arrived yet. It
+// accepts any type allowed under the file's extension, as long as size is
+// within that type's limit; Check runs again once the content is in.
+func (policy UploadPolicy) CheckDeclared(role rbac.Role, filename string, size int64) *httperr.Error {
+	ext := strings.ToLower(filepath.Ext(filename))
+	var maxSize int64 = -1
+	for _, allowed := range policy.rules(role) {
+		if slices.Contains(allowed.Extensions, ext) {
+			maxSize = max(maxSize, allowed.MaxSize)
+		}
+	}
+	if maxSize < 0 {
+		return httperr.UnsupportedMediaType("Unsupported file type", fmt.Sprintf("%s: files named %q can't be uploaded", filename, "*"+ext))
+	}
+	if size > maxSize {
+		return httperr.TooLarge("File too large", fmt.Sprintf("%s: files named %q are limited to %d bytes", filename, "*"+ext, maxSize))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package media
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadPolicyCheck(t *testing.T) {
+	policy := DefaultUploadPolicy()
+	tests := []struct {
+		name           string
+		role           rbac.Role
+		filename       string
+		contentType    string
+		size           int64
+		expectedStatus int
+	}{
+		{name: "allowed image", role: 0, filename: "photo.JPG", contentType: "image/jpeg", size: mb, expectedStatus: 0},
+		{name: "image over the limit", role: 0, filename: "photo.png", contentType: "image/png", size: 11 * mb, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "type not allowed for role", role: 0, filename: "clip.mp4", contentType: "video/mp4", size: mb, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "type allowed for admins", role: 1, filename: "clip.mp4", contentType: "video/mp4", size: mb, expectedStatus: 0},
+		{name: "extension doesn't match content", role: 0, filename: "photo.png", contentType: "image/jpeg", size: mb, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "sniffed html", role: 1, filename: "page.jpg", contentType: "text/html; charset=utf-8", size: 100, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "custom role uses user rules", role: 7, filename: "photo.jpg", contentType: "image/jpeg", size: mb, expectedStatus: 0},
+		{name: "custom role without extended types", role: 7, filename: "clip.mp4", contentType: "video/mp4", size: mb, expectedStatus: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.role, tt.filename, tt.contentType, tt.size)
+			if tt.expectedStatus == 0 {
+				assert.Nil(t, err)
+				return
+			}
+			if assert.NotNil(t, err) {
+				assert.Equal(t, tt.expectedStatus, err.Status)
+				assert.Contains(t, err.Detail, tt.filename)
+			}
+		})
+	}
+}
+
+func TestUploadPolicyCheckDeclared(t *testing.T) {
+	policy := DefaultUploadPolicy()
+	assert.Nil(t, policy.CheckDeclared(1, "clip.mp4", 1024*mb))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, policy.CheckDeclared(1, "clip.mp4", 4096*mb).Status)
+	assert.Equal(t, http.StatusUnsupportedMediaType, policy.CheckDeclared(0, "clip.mp4", mb).Status)
+	assert.Equal(t, http.StatusUnsupportedMediaType, policy.CheckDeclared(0, "script", mb).Status)
+}
+
+func TestParseUploadPolicy(t *testing.T) {
+	policy, err := ParseUploadPolicy([]byte(`{"0": [{"contentType": "image/png", "extensions": [".PNG"], "maxSize": 1024}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, UploadPolicy{0: {{ContentType: "image/png", Extensions: []string{".png"}, MaxSize: 1024}}}, policy)
+
+	_, err = ParseUploadPolicy([]byte(`{"admin": []}`))
+	assert.Error(t, err)
+	_, err = ParseUploadPolicy([]byte(`{"0": [{"contentType": "image/png", "extensions": [".png"]}]}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,145 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+
+	media_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/media"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/imaging"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
+)
+
+// mediaUpload describes a file being attached to a post.
+type mediaUpload struct {
+	PostId       int
+	Filename     string
+	ContentType  string
+	Restricted   bool
+	KeepMetadata bool
+}
+
+// storeMedia strips the file's metadata, stores it under its content hash
+// along with any image variants, and records it against the post. Both the
+// multipart and the resumable upload endpoints finish here. Invalid images are
+// reported as an *httperr.Error.
+func (mediaApi *mediaApi) storeMedia(ctx context.Context, data []byte, upload mediaUpload) (int, error) {
+	var err error
+	if !upload.KeepMetadata {
+		data, err = imaging.StripMetadata(data, upload.ContentType)
+		if err != nil {
+			mediaApi.logger.Sugar().Errorf("error stripping metadata from %s: %v", upload.Filename, err)
+			return 0, httperr.BadRequest("Invalid file", fmt.Sprintf("%s is not a valid %s file", upload.Filename, upload.ContentType))
+		}
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	newMedia := newMediaFor(upload, hash, int64(len(data)))
+
+	open := func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return mediaApi.registerMedia(newMedia, func(newMedia *media_models.NewMedia, referenced bool) error {
+		stored, err := mediaApi.uploadBlob(ctx, newMedia.BlobName, newMedia.Size, open, upload.ContentType, referenced)
+		if err == nil && stored && imaging.Supported(upload.ContentType) {
+			err = mediaApi.storeVariants(ctx, data, upload.Filename, newMedia)
+		}
+		return err
+	})
+}
+
+// storeMediaStream is storeMedia for files too large to hold in memory, which
+// are stored as they are. open must return a fresh reader on every call, as
+// the content is read once to hash it and again to upload it.
+func (mediaApi *mediaApi) storeMediaStream(ctx context.Context, open func() (io.ReadCloser, error), upload mediaUpload) (int, error) {
+	r, err := open()
+	if err != nil {
+		return 0, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	r.Close()
+	if err != nil {
+		return 0, err
+	}
+	newMedia := newMediaFor(upload, hex.EncodeToString(h.Sum(nil)), size)
+	return mediaApi.registerMedia(newMedia, func(newMedia *media_models.NewMedia, referenced bool) error {
+		_, err := mediaApi.uploadBlob(ctx, newMedia.BlobName, size, open, upload.ContentType, referenced)
+		return err
+	})
+}
+
+func newMediaFor(upload mediaUpload, hash string, size int64) media_models.NewMedia {
+	return media_models.NewMedia{
+		PostId:           upload.PostId,
+		BlobName:         "blog-media/" + hash,
+		OriginalFilename: upload.Filename,
+		ContentHash:      hash,
+		Size:             size,
+		ContentType:      upload.ContentType,
+		Restricted:       upload.Restricted,
+	}
+}
+
+// registerMedia reserves the blob of newMedia, calls store to put it in
+// storage, and records the media. Storage is written outside any database
+// transaction; the reservation keeps the blob from being released meanwhile.
+// store is told whether the blob was already referenced or reserved, and may
+// fill in the image details of newMedia.
+func (mediaApi *mediaApi) registerMedia(newMedia media_models.NewMedia, store func(newMedia *media_models.NewMedia, referenced bool) error) (int, error) {
+	referenced, err := mediaApi.mediaRepository.ReserveBlob(newMedia.BlobName)
+	if err != nil {
+		return 0, err
+	}
+	err = store(&newMedia, referenced)
+	mediaId := 0
+	if err == nil {
+		mediaId, err = mediaApi.mediaRepository.UploadMedia(newMedia)
+	}
+	if err != nil {
+		mediaApi.logger.Sugar().Errorf("Error storing media for post %d: %v", newMedia.PostId, err)
+		mediaApi.mediaRepository.ReleaseBlob(newMedia.BlobName)
+		return 0, err
+	}
+	return mediaId, nil
+}
+
+// uploadBlob stores the content unless the blob is already referenced or
+// reserved by other media and in storage. A blob nothing else holds is
+// uploaded again, as it may be being deleted. It reports whether the blob was newly
+// stored. size is the length of the content, passed on to the store.
+func (mediaApi *mediaApi) uploadBlob(ctx context.Context, blobName string, size int64, open func() (io.ReadCloser, error), contentType string, referenced bool) (bool, error) {
+	if referenced {
+		_, err := mediaApi.blobStore.Stat(ctx, blobName)
+		if err == nil {
+			mediaApi.logger.Sugar().Infof("blob %s already exists, reusing it", blobName)
+			return false, nil
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return false, err
+		}
+	}
+	r, err := open()
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	return true, mediaApi.blobStore.Upload(ctx, blobName, storage.WithSize(r, size), contentType)
+}
+
+// readFile reads a whole uploaded file. Only files up to maxInMemoryUpload are
+// processed in memory.
+func readFile(fileHeader *multipart.FileHeader) ([]byte, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
@@ -0,0 +1,482 @@
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	upload_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/uploads"
+	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
+	uploads_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/uploads"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+	v5 "github.com/jackc/pgx/v5"
+)
+
+const (
+	tusVersion = "1.0.0"
+	// maxInMemoryUpload is the largest finished upload that goes through the
+	// same processing as a multipart upload, including metadata stripping and
+	// image variants. Larger files, typically video, are stored as they are.
+	maxInMemoryUpload = 32 << 20
+)
+
+// UploadsApi implements the core and the creation and termination extensions
+// of the tus 1.0 resumable upload protocol (https://tus.io/protocols/resumable-upload).
+// Each PATCH is stored as a chunk in the blob store, so an upload survives
+// disconnects and server restarts. When the last byte arrives the chunks are
+// joined and attached to the post like a multipart upload.
+type UploadsApi interface {
+	Options(w http.ResponseWriter, r *http.Request)
+	CreateUpload(w http.ResponseWriter, r *http.Request)
+	GetUploadOffset(w http.ResponseWriter, r *http.Request)
+	PatchUpload(w http.ResponseWriter, r *http.Request)
+	DeleteUpload(w http.ResponseWriter, r *http.Request)
+}
+
+type uploadsApi struct {
+	uploadsRepository uploads_repo.UploadsRepository
+	media             *mediaApi
+	logger            logger.Logger
+	maxSize           int64
+
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+func NewUploads(uploadsRepo uploads_repo.UploadsRepository, mediaApi *mediaApi, logger logger.Logger, maxSize int64) *uploadsApi {
+	return &uploadsApi{
+		uploadsRepository: uploadsRepo,
+		media:             mediaApi,
+		logger:            logger,
+		maxSize:           maxSize,
+		busy:              map[string]bool{},
+	}
+}
+
+func (uploadsApi *uploadsApi) Options(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Set("Tus-Resumable", tusVersion)
+	header.Set("Tus-Version", tusVersion)
+	header.Set("Tus-Extension", "creation,termination")
+	header.Set("Tus-Max-Size", strconv.FormatInt(uploadsApi.maxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateUpload starts an upload. Upload-Length gives the file size and
+// Upload-Metadata must include postId and filename, and may include restricted.
+func (uploadsApi *uploadsApi) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	if !checkTusVersion(w, r) {
+		return
+	}
+	claims := authorization.RequestClaims(r.Context(), session.Manager.GetString(r.Context(), "session_token"))
+	if claims == nil {
+		httperr.Write(w, httperr.New(http.StatusUnauthorized, "Unauthorized", "You must be logged in to upload media"))
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		httperr.Write(w, httperr.BadRequest("Invalid Upload-Length", "Upload-Length must be a non-negative integer"))
+		return
+	}
+	if length > uploadsApi.maxSize {
+		httperr.Write(w, httperr.New(http.StatusRequestEntityTooLarge, "Upload too large", fmt.Sprintf("uploads are limited to %d bytes", uploadsApi.maxSize)))
+		return
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid Upload-Metadata", err.Error()))
+		return
+	}
+	upload := upload_models.Upload{UserId: claims.Sub, Filename: metadata["filename"], Length: length}
+	if upload.Filename == "" {
+		httperr.Write(w, httperr.BadRequest("Invalid Upload-Metadata", "filename is required"))
+		return
+	}
+	if err := uploadsApi.media.config.UploadPolicy.CheckDeclared(claims.Role, upload.Filename, length); err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	upload.PostId, err = strconv.Atoi(metadata["postId"])
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid Upload-Metadata", "postId must be an integer"))
+		return
+	}
+	if value, ok := metadata["restricted"]; ok {
+		upload.Restricted, err = strconv.ParseBool(value)
+		if err != nil {
+			httperr.Write(w, httperr.BadRequest("Invalid Upload-Metadata", "restricted must be a boolean"))
+			return
+		}
+	}
+
+	post, err := uploadsApi.media.postsRepository.GetPostById(upload.PostId)
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			httperr.Write(w, httperr.NotFound("Post not found", ""))
+			return
+		}
+		httperr.Write(w, httperr.Internal("failed to get post", ""))
+		return
+	}
+	if err := authorization.CanModifyPost(claims, post.UserId); err != nil {
+		httperr.Write(w, err)
+		return
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		httperr.Write(w, httperr.Internal("failed to create upload", ""))
+		return
+	}
+	upload.UploadId = hex.EncodeToString(id)
+	if err := uploadsApi.uploadsRepository.CreateUpload(upload); err != nil {
+		httperr.Write(w, httperr.Internal("failed to create upload", ""))
+		return
+	}
+	if upload.Length == 0 {
+		if err := uploadsApi.finish(r.Context(), w, &upload, claims.Role); err != nil {
+			httperr.Write(w, err)
+			return
+		}
+	}
+	w.Header().Set("Location", "/api/uploads/"+upload.UploadId)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// GetUploadOffset answers HEAD requests with how much of the upload has been
+// received, so a client can resume after a disconnect.
+func (uploadsApi *uploadsApi) GetUploadOffset(w http.ResponseWriter, r *http.Request) {
+	upload, _, err := uploadsApi.loadUpload(w, r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	header := w.Header()
+	header.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	header.Set("Cache-Control", "no-store")
+	if upload.MediaId != nil {
+		header.Set("Media-Id", strconv.Itoa(*upload.MediaId))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// PatchUpload appends the request body at Upload-Offset. Whatever arrives
+// before a disconnect is kept. A PATCH at the end of a completed upload that
+// failed to be attached retries attaching it.
+func (uploadsApi *uploadsApi) PatchUpload(w http.ResponseWriter, r *http.Request) {
+	upload, claims, err := uploadsApi.loadUpload(w, r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		httperr.Write(w, httperr.New(http.StatusUnsupportedMediaType, "Invalid Content-Type", "PATCH requests must use application/offset+octet-stream"))
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		httperr.Write(w, httperr.BadRequest("Invalid Upload-Offset", "Upload-Offset must be a non-negative integer"))
+		return
+	}
+	if !uploadsApi.lock(upload.UploadId) {
+		httperr.Write(w, httperr.New(http.StatusConflict, "Upload busy", "another request is writing to this upload"))
+		return
+	}
+	defer uploadsApi.unlock(upload.UploadId)
+	// Re-read under the lock in case a request that just finished moved it on.
+	upload, err = uploadsApi.uploadsRepository.GetUpload(upload.UploadId)
+	if err != nil {
+		httperr.Write(w, httperr.Internal("failed to get upload", ""))
+		return
+	}
+	if offset != upload.Offset {
+		httperr.Write(w, httperr.New(http.StatusConflict, "Offset mismatch", fmt.Sprintf("the upload is at offset %d", upload.Offset)))
+		return
+	}
+
+	if upload.Offset < upload.Length {
+		received, readErr := uploadsApi.writeChunk(r, upload)
+		if received < 0 {
+			httperr.Write(w, readErr)
+			return
+		}
+		upload.Offset += received
+		if readErr != nil {
+			uploadsApi.logger.Sugar().Infof("upload %s interrupted at offset %d: %v", upload.UploadId, upload.Offset, readErr)
+			return
+		}
+	}
+	if upload.Offset == upload.Length && upload.MediaId == nil {
+		if err := uploadsApi.finish(r.Context(), w, upload, claims.Role); err != nil {
+			httperr.Write(w, err)
+			return
+		}
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUpload cancels an upload and discards what has been received.
+func (uploadsApi *uploadsApi) DeleteUpload(w http.ResponseWriter, r *http.Request) {
+	upload, _, err := uploadsApi.loadUpload(w, r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	if !uploadsApi.lock(upload.UploadId) {
+		httperr.Write(w, httperr.New(http.StatusConflict, "Upload busy", "another request is writing to this upload"))
+		return
+	}
+	defer uploadsApi.unlock(upload.UploadId)
+	if err := uploadsApi.discard(r.Context(), upload.UploadId); err != nil {
+		uploadsApi.logger.Sugar().Errorf("error deleting upload %s : %v", upload.UploadId, err)
+		httperr.Write(w, httperr.Internal("failed to delete upload", ""))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// discard deletes an upload's chunks and then its record.
+func (uploadsApi *uploadsApi) discard(ctx context.Context, uploadId string) error {
+	store := uploadsApi.media.blobStore
+	chunks, err := store.List(ctx, chunkPrefix(uploadId))
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		names[i] = chunk.Name
+	}
+	if err := storage.DeleteAll(ctx, store, names); err != nil {
+		return err
+	}
+	return uploadsApi.uploadsRepository.DeleteUpload(uploadId)
+}
+
+// writeChunk stores the request body as the chunk at the upload's offset and
+// returns how many bytes were received. The body is spooled to disk first so
+// that a partial body can still be stored when the client disconnects, in
+// which case the read error is returned alongside the count. A negative count
+// means nothing was stored and the error should be sent to the client.
+func (uploadsApi *uploadsApi) writeChunk(r *http.Request, upload *upload_models.Upload) (int64, error) {
+	remaining := upload.Length - upload.Offset
+	tmp, err := os.CreateTemp("", "tus-chunk-*")
+	if err != nil {
+		return -1, httperr.Internal("failed to store chunk", "")
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	received, readErr := io.Copy(tmp, io.LimitReader(r.Body, remaining+1))
+	if received > remaining {
+		return -1, httperr.New(http.StatusRequestEntityTooLarge, "Chunk too large", "the body runs past Upload-Length")
+	}
+	if received == 0 {
+		return 0, readErr
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return -1, httperr.Internal("failed to store chunk", "")
+	}
+	// Use a context that outlives a disconnected client so the bytes already
+	// received are kept.
+	ctx := context.WithoutCancel(r.Context())
+	name := chunkName(upload.UploadId, upload.Offset)
+	if err := uploadsApi.media.blobStore.Upload(ctx, name, tmp, "application/octet-stream"); err != nil {
+		uploadsApi.logger.Sugar().Errorf("error storing chunk %s : %v", name, err)
+		return -1, httperr.Internal("failed to store chunk", "")
+	}
+	advanced, err := uploadsApi.uploadsRepository.AdvanceOffset(upload.UploadId, upload.Offset, upload.Offset+received)
+	if err != nil || !advanced {
+		uploadsApi.media.blobStore.Delete(ctx, name)
+		if err != nil {
+			return -1, httperr.Internal("failed to store chunk", "")
+		}
+		return -1, httperr.New(http.StatusConflict, "Offset mismatch", "the upload was changed by another request")
+	}
+	return received, readErr
+}
+
+// finish joins the chunks of a complete upload, checks the file against the
+// upload policy of role, attaches it to its post and deletes the chunks.
+func (uploadsApi *uploadsApi) finish(ctx context.Context, w http.ResponseWriter, upload *upload_models.Upload, role rbac.Role) error {
+	store := uploadsApi.media.blobStore
+	chunks, err := store.List(ctx, chunkPrefix(upload.UploadId))
+	if err != nil {
+		uploadsApi.logger.Sugar().Errorf("error listing chunks of upload %s : %v", upload.UploadId, err)
+		return httperr.Internal("failed to finish upload", "")
+	}
+	// Chunk names hold zero-padded offsets, so name order is upload order.
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Name < chunks[j].Name })
+	names := make([]string, len(chunks))
+	var size int64
+	for i, chunk := range chunks {
+		names[i] = chunk.Name
+		size += chunk.Size
+	}
+	if size != upload.Length {
+		uploadsApi.logger.Sugar().Errorf("upload %s has %d of %d bytes in storage", upload.UploadId, size, upload.Length)
+		return httperr.Internal("failed to finish upload", "stored chunks don't add up to Upload-Length")
+	}
+	open := func() (io.ReadCloser, error) {
+		return storage.NewConcatReader(ctx, store, names), nil
+	}
+
+	contentType, err := detectContentType(open)
+	if err != nil {
+		return httperr.Internal("failed to finish upload", "")
+	}
+	if err := uploadsApi.media.config.UploadPolicy.Check(role, upload.Filename, contentType, upload.Length); err != nil {
+		// The content can't become valid by resuming, so don't keep it around.
+		if discardErr := uploadsApi.discard(ctx, upload.UploadId); discardErr != nil {
+			uploadsApi.logger.Sugar().Errorf("error discarding rejected upload %s : %v", upload.UploadId, discardErr)
+		}
+		return err
+	}
+	mediaUpload := mediaUpload{
+		PostId:      upload.PostId,
+		Filename:    upload.Filename,
+		ContentType: contentType,
+		Restricted:  upload.Restricted,
+	}
+	var mediaId int
+	if upload.Length <= maxInMemoryUpload {
+		r, _ := open()
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return httperr.Internal("failed to finish upload", "")
+		}
+		mediaId, err = uploadsApi.media.storeMedia(ctx, data, mediaUpload)
+	} else {
+		mediaId, err = uploadsApi.media.storeMediaStream(ctx, open, mediaUpload)
+	}
+	if err != nil {
+		var httpErr *httperr.Error
+		if errors.As(err, &httpErr) {
+			return err
+		}
+		uploadsApi.logger.Sugar().Errorf("error attaching upload %s : %v", upload.UploadId, err)
+		return httperr.Internal("failed to finish upload", "")
+	}
+
+	if err := uploadsApi.uploadsRepository.CompleteUpload(upload.UploadId, mediaId); err != nil {
+		return httperr.Internal("failed to finish upload", "")
+	}
+	upload.MediaId = &mediaId
+	if err := storage.DeleteAll(ctx, store, names); err != nil {
+		uploadsApi.logger.Sugar().Errorf("error deleting chunks of upload %s : %v", upload.UploadId, err)
+	}
+	w.Header().Set("Media-Id", strconv.Itoa(mediaId))
+	return nil
+}
+
+// loadUpload checks the protocol version and that the session owns the
+// upload named in the path, and returns the upload and the session's claims.
+func (uploadsApi *uploadsApi) loadUpload(w http.ResponseWriter, r *http.Request) (*upload_models.Upload, *authorization.UserClaim, error) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		return nil, nil, httperr.New(http.StatusPreconditionFailed, "Unsupported tus version", "only tus "+tusVersion+" is supported")
+	}
+	claims := authorization.RequestClaims(r.Context(), session.Manager.GetString(r.Context(), "session_token"))
+	if claims == nil {
+		return nil, nil, httperr.New(http.StatusUnauthorized, "Unauthorized", "You must be logged in to upload media")
+	}
+	upload, err := uploadsApi.uploadsRepository.GetUpload(r.PathValue("id"))
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			return nil, nil, httperr.NotFound("Upload not found", "")
+		}
+		return nil, nil, httperr.Internal("failed to get upload", "")
+	}
+	if upload.UserId != claims.Sub && !authorization.HasPermission(claims, rbac.MediaManage) {
+		return nil, nil, httperr.New(http.StatusForbidden, "Forbidden", "Only the uploader or an admin can access this upload")
+	}
+	return upload, claims, nil
+}
+
+func checkTusVersion(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		httperr.Write(w, httperr.New(http.StatusPreconditionFailed, "Unsupported tus version", "only tus "+tusVersion+" is supported"))
+		return false
+	}
+	return true
+}
+
+func (uploadsApi *uploadsApi) lock(uploadId string) bool {
+	uploadsApi.mu.Lock()
+	defer uploadsApi.mu.Unlock()
+	if uploadsApi.busy[uploadId] {
+		return false
+	}
+	uploadsApi.busy[uploadId] = true
+	return true
+}
+
+func (uploadsApi *uploadsApi) unlock(uploadId string) {
+	uploadsApi.mu.Lock()
+	defer uploadsApi.mu.Unlock()
+	delete(uploadsApi.busy, uploadId)
+}
+
+// parseUploadMetadata decodes the tus Upload-Metadata header, a comma
+// separated list of keys each followed by an optional base64 value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("value of %s is not base64", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+// detectContentType sniffs the first 512 bytes, as getFileContentType does for
+// multipart uploads.
+func detectContentType(open func() (io.ReadCloser, error)) (string, error) {
+	r, err := open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(r, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// chunkPrefix must stay in line with the reconciler, which deletes the chunks
+// of abandoned uploads.
+func chunkPrefix(uploadId string) string {
+	return "uploads/" + uploadId + "/"
+}
+
+func chunkName(uploadId string, offset int64) string {
+	return fmt.Sprintf("%s%020d", chunkPrefix(uploadId), offset)
+}
@@ -0,0 +1,105 @@
+package media
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestParseUploadMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{name: "empty", header: "", expected: map[string]string{}},
+		{
+			name:     "pairs",
+			header:   "postId MTI=,filename Y2xpcC5tcDQ=, restricted dHJ1ZQ==",
+			expected: map[string]string{"postId": "12", "filename": "clip.mp4", "restricted": "true"},
+		},
+		{name: "key without value", header: "restricted", expected: map[string]string{"restricted": ""}},
+		{name: "value not base64", header: "filename clip.mp4", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadata, err := parseUploadMetadata(tt.header)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, metadata)
+		})
+	}
+}
+
+func TestUploadsPreconditions(t *testing.T) {
+	session.Init()
+	api := NewUploads(nil, New(nil, nil, zap.NewNop(), nil, Config{}), zap.NewNop(), 1<<20)
+	mux := http.NewServeMux()
+	mux.HandleFunc("OPTIONS /api/uploads", api.Options)
+	mux.HandleFunc("POST /api/uploads", api.CreateUpload)
+	mux.HandleFunc("HEAD /api/uploads/{id}", api.GetUploadOffset)
+	handler := session.Manager.LoadAndSave(mux)
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		headers        map[string]string
+		expectedStatus int
+		expectedHeader map[string]string
+	}{
+		{
+			name:           "options",
+			method:         http.MethodOptions,
+			url:            "/api/uploads",
+			expectedStatus: http.StatusNoContent,
+			expectedHeader: map[string]string{"Tus-Version": "1.0.0", "Tus-Max-Size": "1048576", "Tus-Extension": "creation,termination"},
+		},
+		{
+			name:           "unsupported version",
+			method:         http.MethodPost,
+			url:            "/api/uploads",
+			headers:        map[string]string{"Tus-Resumable": "0.2.2"},
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedHeader: map[string]string{"Tus-Version": "1.0.0"},
+		},
+		{
+			name:           "create without a session",
+			method:         http.MethodPost,
+			url:            "/api/uploads",
+			headers:        map[string]string{"Tus-Resumable": "1.0.0", "Upload-Length": "10"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "offset without a session",
+			method:         http.MethodHead,
+			url:            "/api/uploads/abc",
+			headers:        map[string]string{"Tus-Resumable": "1.0.0"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, "1.0.0", rr.Header().Get("Tus-Resumable"))
+			for key, value := range tt.expectedHeader {
+				assert.Equal(t, value, rr.Header().Get(key), key)
+			}
+		})
+	}
+}
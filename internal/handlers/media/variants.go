@@ -0,0 +1,72 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+
+	media_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/media"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/imaging"
+)
+
+// storeVariants uploads resized copies of the image next to the original and
+// records them, with the original's dimensions, on newMedia. Images that fail
+// to decode are kept without variants.
+func (mediaApi *mediaApi) storeVariants(ctx context.Context, data []byte, filename string, newMedia *media_models.NewMedia) error {
+	img, err := imaging.Decode(bytes.NewReader(data), newMedia.ContentType)
+	if err != nil {
+		mediaApi.logger.Sugar().Warnf("error decoding %s, storing it without variants: %v", filename, err)
+		return nil
+	}
+	// Variants carry no metadata, so an original that kept its EXIF data
+	// needs its orientation applied to them directly.
+	if orientation := imaging.Orientation(data, newMedia.ContentType); orientation > 1 && orientation <= 8 {
+		img = imaging.Orient(img, orientation)
+	}
+	newMedia.Width = img.Bounds().Dx()
+	newMedia.Height = img.Bounds().Dy()
+
+	variants, err := imaging.Variants(img, newMedia.ContentType, mediaApi.config.VariantWidths)
+	if err != nil {
+		return fmt.Errorf("error resizing %s: %v", filename, err)
+	}
+	for _, variant := range variants {
+		blobName := fmt.Sprintf("%s-w%d%s", newMedia.BlobName, variant.Width, imaging.Extension(variant.ContentType))
+		if err := mediaApi.blobStore.Upload(ctx, blobName, bytes.NewReader(variant.Data), variant.ContentType); err != nil {
+			return err
+		}
+		newMedia.Variants = append(newMedia.Variants, media_models.Variant{
+			BlobName:    blobName,
+			Width:       variant.Width,
+			Height:      variant.Height,
+			ContentType: variant.ContentType,
+			Size:        int64(len(variant.Data)),
+		})
+	}
+	return nil
+}
+
+type srcsetEntry struct {
+	Url         string `json:"url"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+}
+
+func (mediaApi *mediaApi) srcset(r *http.Request, variants []media_models.Variant, restricted bool) ([]srcsetEntry, error) {
+	entries := []srcsetEntry{}
+	for _, variant := range variants {
+		url, err := mediaApi.blobStore.SignedURL(r.Context(), variant.BlobName, mediaApi.urlTTL(restricted))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, srcsetEntry{
+			Url:         url,
+			Width:       variant.Width,
+			Height:      variant.Height,
+			ContentType: variant.ContentType,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,224 @@
+package passwordreset
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	users_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/password"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/mailer"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+)
+
+type PasswordResetApi interface {
+	RequestReset(w http.ResponseWriter, r *http.Request)
+	ConfirmReset(w http.ResponseWriter, r *http.Request)
+}
+
+// Config holds the password reset settings that come from the environment.
+type Config struct {
+	// ResetURL is the page of the site that completes a reset. The token is
+	// added to it as the token query parameter.
+	ResetURL string
+	// TokenTTL is how long a reset link stays valid.
+	TokenTTL time.Duration
+	// PasswordPolicy is the strength new passwords must have.
+	PasswordPolicy password.Policy
+}
+
+const (
+	// addressLimit is how many reset emails one address is sent per
+	// limitWindow.
+	addressLimit = 3
+	// clientLimit is how many resets one client may request per limitWindow.
+	clientLimit = 10
+	limitWindow = time.Hour
+	// maxPending caps the reset requests handled in the background at once.
+	maxPending = 16
+)
+
+type passwordResetApi struct {
+	usersRepository users_repo.UsersRepository
+	mailer          mailer.Mailer
+	logger          logger.Logger
+	config          Config
+	byAddress       *throttle
+	byClient        *throttle
+	// pending tracks reset requests still being handled in the background,
+	// and slots holds one token for each of them.
+	pending sync.WaitGroup
+	slots   chan struct{}
+}
+
+func New(usersRepo users_repo.UsersRepository, mailer mailer.Mailer, logger logger.Logger, config Config) *passwordResetApi {
+	return &passwordResetApi{
+		usersRepository: usersRepo,
+		mailer:          mailer,
+		logger:          logger,
+		config:          config,
+		byAddress:       newThrottle(addressLimit, limitWindow),
+		byClient:        newThrottle(clientLimit, limitWindow),
+		slots:           make(chan struct{}, maxPending),
+	}
+}
+
+// Shutdown waits for reset requests still being handled in the background,
+// giving up when ctx is done.
+func (api *passwordResetApi) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		api.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RequestReset emails a reset link to the address, if a user has it. The
+// response is the same 202 either way and is sent before the user is looked
+// up, so neither its content nor its timing shows whether the address exists.
+// A client that asks too often gets a 429, while an address that was sent too
+// many links recently is quietly sent no more.
+func (api *passwordResetApi) RequestReset(w http.ResponseWriter, r *http.Request) {
+	var request users.PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", err.Error()))
+		return
+	}
+	email := strings.TrimSpace(request.Email)
+	if !strings.Contains(email, "@") {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", "invalid email format"))
+		return
+	}
+
+	if !api.byClient.allow(clientAddress(r)) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(limitWindow.Seconds())))
+		httperr.Write(w, httperr.New(http.StatusTooManyRequests, "Too many requests", "try again later"))
+		return
+	}
+	if !api.byAddress.allow(strings.ToLower(email)) {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	select {
+	case api.slots <- struct{}{}:
+	default:
+		api.logger.Sugar().Warnf("too many password resets in progress, dropping a request")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	api.pending.Add(1)
+	go func() {
+		defer func() {
+			<-api.slots
+			api.pending.Done()
+		}()
+		api.sendResetLink(context.WithoutCancel(r.Context()), email)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (api *passwordResetApi) sendResetLink(ctx context.Context, email string) {
+	user, err := api.usersRepository.GetUserByEmail(email)
+	if err != nil {
+		if !errors.Is(err, users_repo.ErrUserNotFound) {
+			api.logger.Sugar().Errorf("error getting user for password reset: %v", err)
+		}
+		return
+	}
+	userId, err := strconv.Atoi(user.Id)
+	if err != nil {
+		api.logger.Sugar().Errorf("user id %q is not an integer: %v", user.Id, err)
+		return
+	}
+	token, err := newToken()
+	if err != nil {
+		api.logger.Sugar().Errorf("error generating password reset token: %v", err)
+		return
+	}
+	expiresAt := time.Now().Add(api.config.TokenTTL)
+	if err := api.usersRepository.CreatePasswordReset(userId, hashToken(token), expiresAt); err != nil {
+		return
+	}
+	link := api.config.ResetURL + "?token=" + url.QueryEscape(token)
+	err = api.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. To choose a new password, open this link within %s:\n\n%s\n\nIf it wasn't you, you can ignore this email and your password will stay the same.\n",
+			user.FirstName, api.config.TokenTTL, link),
+	})
+	if err != nil {
+		api.logger.Sugar().Errorf("error sending password reset email to user %d: %v", userId, err)
+	}
+}
+
+// ConfirmReset sets a new password using the token from a reset email. A token
+// works once, and not at all after it expires.
+func (api *passwordResetApi) ConfirmReset(w http.ResponseWriter, r *http.Request) {
+	var request users.PasswordResetConfirm
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", err.Error()))
+		return
+	}
+	if request.Token == "" {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", "token is required"))
+		return
+	}
+	if err := api.config.PasswordPolicy.Check(request.Password); err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", err.Error()))
+		return
+	}
+	reset, err := api.usersRepository.ResetPassword(hashToken(request.Token), request.Password)
+	if err != nil {
+		httperr.Write(w, httperr.Internal("failed to reset password", ""))
+		return
+	}
+	if !reset {
+		httperr.Write(w, httperr.BadRequest("Invalid or expired token", "request a new password reset email"))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// clientAddress is the IP address the request came from.
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is what gets stored, so the database never holds a usable token.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
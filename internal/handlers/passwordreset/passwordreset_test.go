@@ -0,0 +1,141 @@
+package passwordreset
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	user_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	users_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/mailer"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeUsersRepository struct {
+	users_repo.UsersRepository
+	users     map[string]user_models.User
+	resets    map[string]int
+	passwords map[int]string
+}
+
+func (f *fakeUsersRepository) GetUserByEmail(email string) (*user_models.User, error) {
+	user, ok := f.users[email]
+	if !ok {
+		return nil, users_repo.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (f *fakeUsersRepository) CreatePasswordReset(userId int, tokenHash string, expiresAt time.Time) error {
+	f.resets[tokenHash] = userId
+	return nil
+}
+
+func (f *fakeUsersRepository) ResetPassword(tokenHash string, password string) (bool, error) {
+	userId, ok := f.resets[tokenHash]
+	if !ok {
+		return false, nil
+	}
+	delete(f.resets, tokenHash)
+	f.passwords[userId] = password
+	return true, nil
+}
+
+type fakeMailer struct {
+	sent []mailer.Message
+}
+
+func (f *fakeMailer) Send(ctx context.Context, message mailer.Message) error {
+	f.sent = append(f.sent, message)
+	return nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	repo := &fakeUsersRepository{
+		users:     map[string]user_models.User{"jane@test.com": {Id: "7", FirstName: "Jane", Email: "jane@test.com"}},
+		resets:    map[string]int{},
+		passwords: map[int]string{},
+	}
+	mail := &fakeMailer{}
+	api := New(repo, mail, zap.NewNop(), Config{ResetURL: "https://example.com/reset-password", TokenTTL: 30 * time.Minute})
+
+	request := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+		api.pending.Wait()
+		return rr
+	}
+
+	// Known and unknown addresses get the same response.
+	assert.Equal(t, http.StatusAccepted, request(api.RequestReset, `{"email": "nobody@test.com"}`).Code)
+	assert.Empty(t, mail.sent)
+	assert.Equal(t, http.StatusAccepted, request(api.RequestReset, `{"email": "jane@test.com"}`).Code)
+	assert.Len(t, mail.sent, 1)
+	assert.Equal(t, http.StatusBadRequest, request(api.RequestReset, `{"email": "jane"}`).Code)
+
+	link := regexp.MustCompile(`https://example.com/reset-password\?token=\S+`).FindString(mail.sent[0].Body)
+	parsed, err := url.Parse(link)
+	assert.NoError(t, err)
+	token := parsed.Query().Get("token")
+	assert.NotEmpty(t, token)
+	assert.NotContains(t, repo.resets, token, "only the hash of the token is stored")
+
+	assert.Equal(t, http.StatusBadRequest, request(api.ConfirmReset, `{"token": "`+token+`", "password": "short"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(api.ConfirmReset, `{"token": "wrong", "password": "new password"}`).Code)
+	assert.Equal(t, http.StatusNoContent, request(api.ConfirmReset, `{"token": "`+token+`", "password": "new password"}`).Code)
+	assert.Equal(t, "new password", repo.passwords[7])
+	// A token only works once.
+	assert.Equal(t, http.StatusBadRequest, request(api.ConfirmReset, `{"token": "`+token+`", "password": "another password"}`).Code)
+}
+
+func TestRequestResetThrottling(t *testing.T) {
+	repo := &fakeUsersRepository{
+		users:  map[string]user_models.User{"jane@test.com": {Id: "7", FirstName: "Jane", Email: "jane@test.com"}},
+		resets: map[string]int{},
+	}
+	mail := &fakeMailer{}
+	api := New(repo, mail, zap.NewNop(), Config{ResetURL: "https://example.com/reset-password", TokenTTL: 30 * time.Minute})
+
+	request := func(remoteAddr, email string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email": "`+email+`"}`))
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		api.RequestReset(rr, req)
+		assert.NoError(t, api.Shutdown(context.Background()))
+		return rr.Code
+	}
+
+	for i := 0; i < addressLimit; i++ {
+		assert.Equal(t, http.StatusAccepted, request(fmt.Sprintf("192.0.2.%d:1234", i), "jane@test.com"))
+	}
+	assert.Len(t, mail.sent, addressLimit)
+	assert.Equal(t, http.StatusAccepted, request("192.0.2.50:1234", "Jane@test.com"))
+	assert.Len(t, mail.sent, addressLimit, "an address is sent no more once it reaches the limit, whatever its case")
+
+	for i := 0; i < clientLimit; i++ {
+		assert.Equal(t, http.StatusAccepted, request("198.51.100.1:1234", fmt.Sprintf("user%d@test.com", i)))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, request("198.51.100.1:4321", "other@test.com"))
+}
+
+func TestThrottle(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newThrottle(2, time.Hour)
+	limiter.now = func() time.Time { return now }
+
+	assert.True(t, limiter.allow("a"))
+	assert.True(t, limiter.allow("a"))
+	assert.False(t, limiter.allow("a"))
+	assert.True(t, limiter.allow("b"), "counted per key")
+
+	now = now.Add(time.Hour)
+	assert.True(t, limiter.allow("a"), "allowed again in the next window")
+	assert.NotContains(t, limiter.counts, "b", "forgotten once its window ends")
+}
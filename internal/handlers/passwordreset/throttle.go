@@ -0,0 +1,63 @@
+package passwordreset
+
+import (
+	"sync"
+	"time"
+)
+
+// throttle allows up to limit events per key in each window. Windows are
+// fixed and start with the first event for the key.
+type throttle struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	counts    map[string]*windowCount
+	nextSweep time.Time
+}
+
+type windowCount struct {
+	start time.Time
+	n     int
+}
+
+func newThrottle(limit int, window time.Duration) *throttle {
+	return &throttle{
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+		counts: map[string]*windowCount{},
+	}
+}
+
+// allow records an event for key and reports whether it is within the limit.
+func (t *throttle) allow(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	if !now.Before(t.nextSweep) {
+		t.sweep(now)
+	}
+	count, ok := t.counts[key]
+	if !ok || now.Sub(count.start) >= t.window {
+		count = &windowCount{start: now}
+		t.counts[key] = count
+	}
+	if count.n >= t.limit {
+		return false
+	}
+	count.n++
+	return true
+}
+
+// sweep forgets keys whose window has ended, so the map doesn't keep every
+// key ever seen.
+func (t *throttle) sweep(now time.Time) {
+	for key, count := range t.counts {
+		if now.Sub(count.start) >= t.window {
+			delete(t.counts, key)
+		}
+	}
+	t.nextSweep = now.Add(t.window)
+}
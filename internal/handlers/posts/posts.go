@@ -1,17 +1,23 @@
 package posts
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	post_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/posts"
 	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
 	posts_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/posts"
 	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/markdown"
 	"github.com/KylerJacobson/Go-Blog-API/logger"
 	v5 "github.com/jackc/pgx/v5"
 )
@@ -22,29 +28,50 @@ type PostsApi interface {
 	GetPostById(w http.ResponseWriter, r *http.Request)
 	DeletePostById(w http.ResponseWriter, r *http.Request)
 	CreatePost(w http.ResponseWriter, r *http.Request)
+	GetPostBySlug(w http.ResponseWriter, r *http.Request)
+	SearchPosts(w http.ResponseWriter, r *http.Request)
 }
 
 type postsApi struct {
 	postsRepository posts_repo.PostsRepository
 	logger          logger.Logger
+	renderer        *markdown.Renderer
 }
 
-func New(postsRepo posts_repo.PostsRepository, logger logger.Logger) *postsApi {
+func New(postsRepo posts_repo.PostsRepository, logger logger.Logger, renderer *markdown.Renderer) *postsApi {
 	return &postsApi{
 		postsRepository: postsRepo,
 		logger:          logger,
+		renderer:        renderer,
 	}
 }
 
+const (
+	defaultPageSize = 10
+	maxPageSize     = 50
+)
+
+// GetRecentPosts pages through the newest posts. Restricted posts are only
+// included for sessions that may read them.
 func (postsApi *postsApi) GetRecentPosts(w http.ResponseWriter, r *http.Request) {
-	posts, err := postsApi.postsRepository.GetRecentPosts()
+	query, err := parsePostsQuery(r)
+	if err != nil {
+		postsApi.logger.Sugar().Errorf("invalid pagination parameters: %v", err)
+		httperr.Write(w, err)
+		return
+	}
+	list := postsApi.postsRepository.GetRecentPublicPosts
+	if canViewRestricted(authorization.RequestClaims(r.Context(), session.Manager.GetString(r.Context(), "session_token"))) {
+		list = postsApi.postsRepository.GetRecentPosts
+	}
+	posts, err := list(query)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		b, _ := json.Marshal(err)
 		w.Write(b)
 		return
 	}
-	b, err := json.Marshal(posts)
+	b, err := json.Marshal(newPostsPage(postsApi.renderPosts(posts), query.Limit))
 	if err != nil {
 		postsApi.logger.Sugar().Errorf("error unmarshalling recent posts : %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -59,27 +86,41 @@ func (postsApi *postsApi) GetRecentPosts(w http.ResponseWriter, r *http.Request)
 
 func (postsApi *postsApi) GetPosts(w http.ResponseWriter, r *http.Request) {
 	token := session.Manager.GetString(r.Context(), "session_token")
-
-	fmt.Println(token)
-	claims := authorization.DecodeToken(token)
-	fmt.Println(claims)
-	// NON_PRIVILEGED: 0,
-	// ADMIN: 1,
-	// PRIVILEGED: 2,
+	claims := authorization.RequestClaims(r.Context(), token)
+	query, err := parsePostsQuery(r)
+	if err != nil {
+		postsApi.logger.Sugar().Errorf("invalid pagination parameters: %v", err)
+		httperr.Write(w, err)
+		return
+	}
+	if status := r.URL.Query().Get("status"); status != "" && status != post_models.StatusPublished {
+		// Unpublished posts are only listed for their author, or for admins.
+		if !validStatus(status) {
+			httperr.Write(w, httperr.BadRequest("Invalid status", fmt.Sprintf("unknown post status %q", status)))
+			return
+		}
+		if claims == nil {
+			httperr.Write(w, httperr.New(http.StatusUnauthorized, "Unauthorized", "you must be logged in to list unpublished posts"))
+			return
+		}
+		query.Status = status
+		if !authorization.HasPermission(claims, rbac.PostReadUnpublishedAny) {
+			query.AuthorId = claims.Sub
+		}
+	}
 	var posts = []post_models.Post{}
-	var err = errors.New("")
-	if claims != nil && claims.ExpiresAt.Time.After(time.Now()) && (claims.Role == 1 || claims.Role == 2) {
-		posts, err = postsApi.postsRepository.GetRecentPosts()
+	if canViewRestricted(claims) {
+		posts, err = postsApi.postsRepository.GetRecentPosts(query)
 		if err != nil {
 			postsApi.logger.Sugar().Errorf("error getting all recent posts : %v", err)
 		}
 	} else {
-		posts, err = postsApi.postsRepository.GetRecentPublicPosts()
+		posts, err = postsApi.postsRepository.GetRecentPublicPosts(query)
 		if err != nil {
 			postsApi.logger.Sugar().Errorf("error getting all recent public posts : %v", err)
 		}
 	}
-	b, err := json.Marshal(posts)
+	b, err := json.Marshal(newPostsPage(postsApi.renderPosts(posts), query.Limit))
 	if err != nil {
 		postsApi.logger.Sugar().Errorf("error unmarshalling recent public posts : %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -91,15 +132,70 @@ func (postsApi *postsApi) GetPosts(w http.ResponseWriter, r *http.Request) {
 	w.Write(b)
 }
 
+func (postsApi *postsApi) SearchPosts(w http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	if text == "" {
+		httperr.Write(w, httperr.BadRequest("Invalid search", "q must not be empty"))
+		return
+	}
+	query, err := parsePostsQuery(r)
+	if err != nil {
+		postsApi.logger.Sugar().Errorf("invalid pagination parameters: %v", err)
+		httperr.Write(w, err)
+		return
+	}
+	offset := 0
+	if o := r.URL.Query().Get("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			httperr.Write(w, httperr.BadRequest("Invalid offset", "offset must be a non-negative integer"))
+			return
+		}
+	}
+
+	token := session.Manager.GetString(r.Context(), "session_token")
+	claims := authorization.RequestClaims(r.Context(), token)
+	results, err := postsApi.postsRepository.SearchPosts(post_models.SearchQuery{
+		Text:              text,
+		IncludeRestricted: canViewRestricted(claims),
+		Limit:             query.Limit,
+		Offset:            offset,
+	})
+	if err != nil {
+		postsApi.logger.Sugar().Errorf("error searching posts for %q : %v", text, err)
+		httperr.Write(w, httperr.Internal("failed to search posts", ""))
+		return
+	}
+
+	page := post_models.SearchPage{Results: results}
+	if page.Results == nil {
+		page.Results = []post_models.SearchResult{}
+	}
+	if len(results) >= query.Limit {
+		page.Results = results[:query.Limit-1]
+		next := offset + len(page.Results)
+		page.NextOffset = &next
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(page)
+}
+
 func (postsApi *postsApi) GetRecentPublicPosts(w http.ResponseWriter, r *http.Request) {
-	posts, err := postsApi.postsRepository.GetRecentPublicPosts()
+	query, err := parsePostsQuery(r)
+	if err != nil {
+		postsApi.logger.Sugar().Errorf("invalid pagination parameters: %v", err)
+		httperr.Write(w, err)
+		return
+	}
+	posts, err := postsApi.postsRepository.GetRecentPublicPosts(query)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		b, _ := json.Marshal(err)
 		w.Write(b)
 		return
 	}
-	b, err := json.Marshal(posts)
+	b, err := json.Marshal(newPostsPage(postsApi.renderPosts(posts), query.Limit))
 	if err != nil {
 		postsApi.logger.Sugar().Errorf("error unmarshalling recent public posts : %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -131,6 +227,13 @@ func (postsApi *postsApi) GetPostById(w http.ResponseWriter, r *http.Request) {
 		w.Write(b)
 		return
 	}
+	token := session.Manager.GetString(r.Context(), "session_token")
+	if !canViewUnpublished(authorization.RequestClaims(r.Context(), token), post) {
+		postsApi.logger.Sugar().Infof("Post %v is %s and hidden from this session", val, post.Status)
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	postsApi.renderPost(post)
 	b, err := json.Marshal(post)
 	if err != nil {
 		postsApi.logger.Sugar().Errorf("error unmarshalling post (%d) : %v", id, err)
@@ -143,18 +246,46 @@ func (postsApi *postsApi) GetPostById(w http.ResponseWriter, r *http.Request) {
 	w.Write(b)
 }
 
+// GetPostBySlug serves GET /api/p/{slug}. Old slugs of renamed posts answer
+// with a permanent redirect to the current slug.
+func (postsApi *postsApi) GetPostBySlug(w http.ResponseWriter, r *http.Request) {
+	slug := r.PathValue("slug")
+	post, err := postsApi.postsRepository.GetPostBySlug(slug)
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			httperr.Write(w, httperr.NotFound("Post not found", ""))
+			return
+		}
+		postsApi.logger.Sugar().Errorf("error getting post by slug %s : %v", slug, err)
+		httperr.Write(w, httperr.Internal("failed to get post", ""))
+		return
+	}
+	token := session.Manager.GetString(r.Context(), "session_token")
+	claims := authorization.RequestClaims(r.Context(), token)
+	if !canViewUnpublished(claims, post) || (post.Restricted && !canViewRestricted(claims)) {
+		httperr.Write(w, httperr.NotFound("Post not found", ""))
+		return
+	}
+	if post.Slug != slug {
+		http.Redirect(w, r, "/api/p/"+url.PathEscape(post.Slug), http.StatusMovedPermanently)
+		return
+	}
+	postsApi.renderPost(post)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(post)
+}
+
 func (postsApi *postsApi) DeletePostById(w http.ResponseWriter, r *http.Request) {
-	id := r.PathValue("id")
-	val, err := strconv.Atoi(id)
+	post, _, err := postsApi.loadPostFor(r, authorization.CanDeletePost)
 	if err != nil {
-		postsApi.logger.Sugar().Errorf("DeletePostById parameter was not an integer: %v", err)
-		http.Error(w, "postId must be an integer", http.StatusBadRequest)
+		httperr.Write(w, err)
 		return
 	}
-	err = postsApi.postsRepository.DeletePostById(val)
+	err = postsApi.postsRepository.DeletePostById(post.PostId)
 	if err != nil {
 		if errors.Is(err, v5.ErrNoRows) {
-			postsApi.logger.Sugar().Infof("Post %v does not exist in the database", val)
+			postsApi.logger.Sugar().Infof("Post %v does not exist in the database", post.PostId)
 			http.Error(w, "Post not found", http.StatusNotFound)
 			return
 		}
@@ -169,10 +300,7 @@ func (postsApi *postsApi) DeletePostById(w http.ResponseWriter, r *http.Request)
 func (postsApi *postsApi) CreatePost(w http.ResponseWriter, r *http.Request) {
 
 	token := session.Manager.GetString(r.Context(), "session_token")
-
-	fmt.Println(token)
-	claims := authorization.DecodeToken(token)
-	fmt.Println(claims)
+	claims := authorization.RequestClaims(r.Context(), token)
 
 	var post post_models.FrontendPostRequest
 	// bytedata, _ := io.ReadAll(r.Body)
@@ -186,7 +314,14 @@ func (postsApi *postsApi) CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	post.Tags = normalizeTags(post.Tags)
+	if post.Status == "" {
+		post.Status = post_models.StatusPublished
+	}
 	err = validatePost(post.PostRequestBody)
+	if err == nil {
+		err = validateSchedule(post.PostRequestBody)
+	}
 	if err != nil {
 		postsApi.logger.Sugar().Errorf("the post was not formatter correctly: %v", err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -210,19 +345,13 @@ func (postsApi *postsApi) CreatePost(w http.ResponseWriter, r *http.Request) {
 }
 
 func (postsApi *postsApi) UpdatePost(w http.ResponseWriter, r *http.Request) {
-	token := session.Manager.GetString(r.Context(), "session_token")
-
-	fmt.Println(token)
-	claims := authorization.DecodeToken(token)
-	fmt.Println(claims)
-	var post post_models.FrontendPostRequest
-	id := r.PathValue("id")
-	postId, err := strconv.Atoi(id)
+	existing, claims, err := postsApi.loadEditablePost(r)
 	if err != nil {
-		postsApi.logger.Sugar().Errorf("UpdatePost parameter was not an integer: %v", err)
-		http.Error(w, "postId must be an integer", http.StatusBadRequest)
+		httperr.Write(w, err)
 		return
 	}
+	postId := existing.PostId
+	var post post_models.FrontendPostRequest
 	err = json.NewDecoder(r.Body).Decode(&post)
 	if err != nil {
 		postsApi.logger.Sugar().Errorf("Error decoding the post request body: %v", err)
@@ -231,7 +360,21 @@ func (postsApi *postsApi) UpdatePost(w http.ResponseWriter, r *http.Request) {
 		w.Write(b)
 		return
 	}
+	post.Tags = normalizeTags(post.Tags)
+	// An edit that leaves out the status keeps the current one, so editing a
+	// draft or scheduled post doesn't publish it.
+	if post.Status == "" {
+		post.Status = existing.Status
+		if post.PublishAt == nil {
+			post.PublishAt = existing.PublishAt
+		}
+	}
 	err = validatePost(post.PostRequestBody)
+	// A scheduled post whose time has just come stays editable until the
+	// publisher gets to it, so the schedule is only checked when it changes.
+	if err == nil && (post.Status != existing.Status || !samePublishAt(post.PublishAt, existing.PublishAt)) {
+		err = validateSchedule(post.PostRequestBody)
+	}
 	if err != nil {
 		postsApi.logger.Sugar().Errorf("the post was not formatter correctly: %v", err)
 
@@ -262,6 +405,74 @@ func (postsApi *postsApi) UpdatePost(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// loadEditablePost loads the post named by the {id} path value, provided the
+// session may modify it. The session is checked before the post is looked up
+// so anonymous callers can't probe which posts exist.
+func (postsApi *postsApi) loadEditablePost(r *http.Request) (*post_models.Post, *authorization.UserClaim, error) {
+	return postsApi.loadPostFor(r, authorization.CanModifyPost)
+}
+
+// loadPostFor is loadEditablePost with the access check given by allowed, such
+// as authorization.CanDeletePost.
+func (postsApi *postsApi) loadPostFor(r *http.Request, allowed func(*authorization.UserClaim, int) error) (*post_models.Post, *authorization.UserClaim, error) {
+	postId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return nil, nil, httperr.BadRequest("Invalid post id", "postId must be an integer")
+	}
+	token := session.Manager.GetString(r.Context(), "session_token")
+	claims := authorization.RequestClaims(r.Context(), token)
+	if claims == nil {
+		return nil, nil, allowed(claims, 0)
+	}
+	post, err := postsApi.postsRepository.GetPostById(postId)
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			return nil, nil, httperr.NotFound("Post not found", "")
+		}
+		postsApi.logger.Sugar().Errorf("error getting post %d : %v", postId, err)
+		return nil, nil, httperr.Internal("failed to get post", "")
+	}
+	if err := allowed(claims, post.UserId); err != nil {
+		postsApi.logger.Sugar().Infof("user %d may not modify post %d by user %d", claims.Sub, post.PostId, post.UserId)
+		return nil, nil, err
+	}
+	return post, claims, nil
+}
+
+// canViewRestricted reports whether the session's role may read restricted
+// posts, which admins and privileged users can by default.
+func canViewRestricted(claims *authorization.UserClaim) bool {
+	return claims != nil && claims.ExpiresAt.Time.After(time.Now()) && authorization.HasPermission(claims, rbac.PostReadRestricted)
+}
+
+// renderPost fills in the HTML rendering of the post's Markdown content. A
+// post that fails to render is still served with its raw content.
+func (postsApi *postsApi) renderPost(post *post_models.Post) {
+	html, err := postsApi.renderer.Render(post.Content)
+	if err != nil {
+		postsApi.logger.Sugar().Errorf("error rendering post %d : %v", post.PostId, err)
+		return
+	}
+	post.ContentHTML = html
+}
+
+func (postsApi *postsApi) renderPosts(posts []post_models.Post) []post_models.Post {
+	for i := range posts {
+		postsApi.renderPost(&posts[i])
+	}
+	return posts
+}
+
+// canViewUnpublished reports whether the session may see a post that isn't
+// published yet. Drafts, scheduled and archived posts are only visible to
+// their author and roles with post:read:unpublished:any.
+func canViewUnpublished(claims *authorization.UserClaim, post *post_models.Post) bool {
+	if post.Status == post_models.StatusPublished {
+		return true
+	}
+	return claims != nil && (claims.Sub == post.UserId || authorization.HasPermission(claims, rbac.PostReadUnpublishedAny))
+}
+
 func validatePost(post post_models.PostRequestBody) error {
 	if len(post.Title) < 1 {
 		return fmt.Errorf("post title must not be empty")
@@ -269,5 +480,122 @@ func validatePost(post post_models.PostRequestBody) error {
 	if len(post.Content) < 1 {
 		return fmt.Errorf("post content must not be empty")
 	}
+	if !validStatus(post.Status) {
+		return fmt.Errorf("unknown post status %q", post.Status)
+	}
+	if len(post.Tags) > maxTags {
+		return fmt.Errorf("a post can have at most %d tags", maxTags)
+	}
+	for _, tag := range post.Tags {
+		if len(tag) > maxTagLength {
+			return fmt.Errorf("tag %q is longer than %d characters", tag, maxTagLength)
+		}
+	}
 	return nil
 }
+
+// validateSchedule checks that a scheduled post is due in the future.
+func validateSchedule(post post_models.PostRequestBody) error {
+	if post.Status == post_models.StatusScheduled && (post.PublishAt == nil || !post.PublishAt.After(time.Now())) {
+		return fmt.Errorf("scheduled posts need a publish_at in the future")
+	}
+	return nil
+}
+
+func samePublishAt(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func validStatus(status string) bool {
+	switch status {
+	case post_models.StatusDraft, post_models.StatusScheduled, post_models.StatusPublished, post_models.StatusArchived:
+		return true
+	}
+	return false
+}
+
+const (
+	maxTags      = 10
+	maxTagLength = 50
+)
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// normalizeTags lowercases and trims tags, dropping blanks and duplicates. A nil
+// slice stays nil so an update without tags keeps the post's current tags.
+func normalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// parsePostsQuery reads the limit and cursor query parameters. The returned
+// query asks the repository for one extra post so newPostsPage can tell
+// whether another page follows.
+func parsePostsQuery(r *http.Request) (post_models.PostsQuery, error) {
+	limit := defaultPageSize
+	if l := r.URL.Query().Get("limit"); l != "" {
+		val, err := strconv.Atoi(l)
+		if err != nil || val < 1 {
+			return post_models.PostsQuery{}, httperr.BadRequest("Invalid limit", "limit must be a positive integer")
+		}
+		limit = min(val, maxPageSize)
+	}
+	query := post_models.PostsQuery{Limit: limit + 1, Tag: normalizeTag(r.URL.Query().Get("tag"))}
+	if c := r.URL.Query().Get("cursor"); c != "" {
+		cursor, err := decodeCursor(c)
+		if err != nil {
+			return post_models.PostsQuery{}, httperr.BadRequest("Invalid cursor", err.Error())
+		}
+		query.Cursor = cursor
+	}
+	return query, nil
+}
+
+// newPostsPage trims the extra post fetched by parsePostsQuery and turns the
+// last post of the page into the next cursor.
+func newPostsPage(posts []post_models.Post, limit int) post_models.PostsPage {
+	if posts == nil {
+		posts = []post_models.Post{}
+	}
+	page := post_models.PostsPage{Posts: posts}
+	if len(posts) >= limit {
+		page.Posts = posts[:limit-1]
+		last := page.Posts[len(page.Posts)-1]
+		page.NextCursor = encodeCursor(post_models.Cursor{CreatedAt: last.CreatedAt, PostId: last.PostId})
+	}
+	return page
+}
+
+func encodeCursor(cursor post_models.Cursor) string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*post_models.Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("cursor is not valid")
+	}
+	var cursor post_models.Cursor
+	if err := json.Unmarshal(b, &cursor); err != nil || cursor.PostId < 1 {
+		return nil, fmt.Errorf("cursor is not valid")
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,287 @@
+package posts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	post_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/posts"
+	posts_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/posts"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/markdown"
+	"github.com/golang-jwt/jwt/v5"
+	v5 "github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursor := post_models.Cursor{CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123000, time.UTC), PostId: 42}
+
+	decoded, err := decodeCursor(encodeCursor(cursor))
+
+	assert.NoError(t, err)
+	assert.True(t, cursor.CreatedAt.Equal(decoded.CreatedAt))
+	assert.Equal(t, cursor.PostId, decoded.PostId)
+}
+
+func TestParsePostsQuery(t *testing.T) {
+	tests := []struct {
+		name          string
+		url           string
+		expectedLimit int
+		expectError   bool
+	}{
+		{name: "default_limit", url: "/api/posts", expectedLimit: defaultPageSize + 1},
+		{name: "custom_limit", url: "/api/posts?limit=5", expectedLimit: 6},
+		{name: "limit_is_capped", url: "/api/posts?limit=500", expectedLimit: maxPageSize + 1},
+		{name: "invalid_limit", url: "/api/posts?limit=abc", expectError: true},
+		{name: "invalid_cursor", url: "/api/posts?cursor=not-a-cursor", expectError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := parsePostsQuery(httptest.NewRequest("GET", tt.url, nil))
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedLimit, query.Limit)
+		})
+	}
+}
+
+func TestNewPostsPage(t *testing.T) {
+	now := time.Now()
+	posts := []post_models.Post{
+		{PostId: 3, CreatedAt: now},
+		{PostId: 2, CreatedAt: now.Add(-time.Minute)},
+		{PostId: 1, CreatedAt: now.Add(-2 * time.Minute)},
+	}
+
+	page := newPostsPage(posts, 3)
+	assert.Len(t, page.Posts, 2)
+	cursor, err := decodeCursor(page.NextCursor)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, cursor.PostId)
+
+	lastPage := newPostsPage(posts[:2], 3)
+	assert.Len(t, lastPage.Posts, 2)
+	assert.Empty(t, lastPage.NextCursor)
+}
+
+func TestNormalizeTags(t *testing.T) {
+	assert.Nil(t, normalizeTags(nil))
+	assert.Equal(t, []string{}, normalizeTags([]string{" ", ""}))
+	assert.Equal(t, []string{"go", "postgres"}, normalizeTags([]string{" Go", "postgres", "GO "}))
+}
+
+// fakePostsRepository keeps posts in memory and records what was written.
+type fakePostsRepository struct {
+	posts_repo.PostsRepository
+	posts   map[int]*post_models.Post
+	written *post_models.PostRequestBody
+	// oldSlugs maps slugs a post had before it was renamed to its id.
+	oldSlugs map[string]int
+}
+
+func (f *fakePostsRepository) GetPostBySlug(slug string) (*post_models.Post, error) {
+	for _, post := range f.posts {
+		if post.Slug == slug {
+			return post, nil
+		}
+	}
+	if post, ok := f.posts[f.oldSlugs[slug]]; ok {
+		return post, nil
+	}
+	return nil, v5.ErrNoRows
+}
+
+func (f *fakePostsRepository) GetRecentPosts(query post_models.PostsQuery) ([]post_models.Post, error) {
+	return f.list(true), nil
+}
+
+func (f *fakePostsRepository) GetRecentPublicPosts(query post_models.PostsQuery) ([]post_models.Post, error) {
+	return f.list(false), nil
+}
+
+func (f *fakePostsRepository) list(includeRestricted bool) []post_models.Post {
+	posts := []post_models.Post{}
+	for _, post := range f.posts {
+		if includeRestricted || !post.Restricted {
+			posts = append(posts, *post)
+		}
+	}
+	return posts
+}
+
+func (f *fakePostsRepository) GetPostById(postId int) (*post_models.Post, error) {
+	post, ok := f.posts[postId]
+	if !ok {
+		return nil, v5.ErrNoRows
+	}
+	copied := *post
+	return &copied, nil
+}
+
+func (f *fakePostsRepository) CreatePost(post post_models.PostRequestBody, userId int) (int, error) {
+	f.written = &post
+	return 99, nil
+}
+
+func (f *fakePostsRepository) UpdatePost(post post_models.PostRequestBody, postId, editorId int) (*post_models.PostRequestBody, error) {
+	f.written = &post
+	return &post, nil
+}
+
+// serveAs runs handler behind a session signed in as user, or signed out when
+// user is 0.
+func serveAs(t *testing.T, handler http.Handler, user, role int, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	token := ""
+	if user != 0 {
+		var err error
+		token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": user, "role": role, "exp": time.Now().Add(time.Hour).Unix()}).SignedString([]byte("secret"))
+		assert.NoError(t, err)
+	}
+	rr := httptest.NewRecorder()
+	session.Manager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session.Manager.Put(r.Context(), "session_token", token)
+		handler.ServeHTTP(w, r)
+	})).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPostStatus(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	publishAt := time.Now().Add(24 * time.Hour)
+	due := time.Now().Add(-time.Second)
+	repo := &fakePostsRepository{posts: map[int]*post_models.Post{
+		1: {PostId: 1, UserId: 7, Title: "Draft", Content: "draft", Status: post_models.StatusDraft},
+		2: {PostId: 2, UserId: 7, Title: "Later", Content: "later", Status: post_models.StatusScheduled, PublishAt: &publishAt},
+		3: {PostId: 3, UserId: 7, Title: "Due", Content: "due", Status: post_models.StatusScheduled, PublishAt: &due},
+	}}
+	api := New(repo, zap.NewNop(), markdown.NewRenderer(8))
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/posts", api.CreatePost)
+	mux.HandleFunc("PUT /api/posts/{id}", api.UpdatePost)
+
+	tests := []struct {
+		name              string
+		method            string
+		url               string
+		body              string
+		expectedStatus    int
+		expectedPostState string
+		expectedPublishAt *time.Time
+	}{
+		{name: "create defaults to published", method: http.MethodPost, url: "/api/posts", body: `{"postData": {"title": "New", "content": "body"}}`, expectedStatus: http.StatusOK, expectedPostState: post_models.StatusPublished},
+		{name: "update keeps a draft", method: http.MethodPut, url: "/api/posts/1", body: `{"postData": {"title": "Draft", "content": "edited"}}`, expectedStatus: http.StatusOK, expectedPostState: post_models.StatusDraft},
+		{name: "update keeps the schedule", method: http.MethodPut, url: "/api/posts/2", body: `{"postData": {"title": "Later", "content": "edited"}}`, expectedStatus: http.StatusOK, expectedPostState: post_models.StatusScheduled, expectedPublishAt: &publishAt},
+		{name: "update publishes when asked", method: http.MethodPut, url: "/api/posts/1", body: `{"postData": {"title": "Draft", "content": "edited", "status": "published"}}`, expectedStatus: http.StatusOK, expectedPostState: post_models.StatusPublished},
+		{name: "unknown status", method: http.MethodPost, url: "/api/posts", body: `{"postData": {"title": "New", "content": "body", "status": "hidden"}}`, expectedStatus: http.StatusBadRequest},
+		{name: "scheduled without publish_at", method: http.MethodPut, url: "/api/posts/1", body: `{"postData": {"title": "Draft", "content": "edited", "status": "scheduled"}}`, expectedStatus: http.StatusBadRequest},
+		{name: "update a post that just fell due", method: http.MethodPut, url: "/api/posts/3", body: `{"postData": {"title": "Due", "content": "edited"}}`, expectedStatus: http.StatusOK, expectedPostState: post_models.StatusScheduled, expectedPublishAt: &due},
+		{name: "reschedule into the past", method: http.MethodPut, url: "/api/posts/3", body: `{"postData": {"title": "Due", "content": "edited", "status": "scheduled", "publish_at": "2000-01-01T00:00:00Z"}}`, expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo.written = nil
+			rr := serveAs(t, mux, 7, 0, httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus != http.StatusOK {
+				assert.Nil(t, repo.written)
+				return
+			}
+			if assert.NotNil(t, repo.written) {
+				assert.Equal(t, tt.expectedPostState, repo.written.Status)
+				assert.Equal(t, tt.expectedPublishAt, repo.written.PublishAt)
+			}
+		})
+	}
+}
+
+func TestUnpublishedVisibility(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	repo := &fakePostsRepository{posts: map[int]*post_models.Post{
+		1: {PostId: 1, UserId: 7, Title: "Draft", Content: "draft", Status: post_models.StatusDraft},
+		2: {PostId: 2, UserId: 7, Title: "Live", Content: "live", Status: post_models.StatusPublished},
+	}}
+	api := New(repo, zap.NewNop(), markdown.NewRenderer(8))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/posts/{id}", api.GetPostById)
+
+	tests := []struct {
+		name           string
+		url            string
+		user           int
+		role           int
+		expectedStatus int
+	}{
+		{name: "published to anyone", url: "/api/posts/2", expectedStatus: http.StatusOK},
+		{name: "draft hidden when signed out", url: "/api/posts/1", expectedStatus: http.StatusNotFound},
+		{name: "draft hidden from other users", url: "/api/posts/1", user: 8, expectedStatus: http.StatusNotFound},
+		{name: "draft shown to its author", url: "/api/posts/1", user: 7, expectedStatus: http.StatusOK},
+		{name: "draft shown to admins", url: "/api/posts/1", user: 1, role: 1, expectedStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveAs(t, mux, tt.user, tt.role, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestGetRecentPostsRestricted(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	repo := &fakePostsRepository{posts: map[int]*post_models.Post{
+		1: {PostId: 1, Title: "Family", Content: "restricted", Restricted: true, Status: post_models.StatusPublished},
+		2: {PostId: 2, Title: "Public", Content: "public", Status: post_models.StatusPublished},
+	}}
+	api := New(repo, zap.NewNop(), markdown.NewRenderer(8))
+
+	anonymous := serveAs(t, http.HandlerFunc(api.GetRecentPosts), 0, 0, httptest.NewRequest(http.MethodGet, "/api/posts/recent", nil))
+	assert.Equal(t, http.StatusOK, anonymous.Code)
+	assert.NotContains(t, anonymous.Body.String(), "Family")
+
+	privileged := serveAs(t, http.HandlerFunc(api.GetRecentPosts), 5, 2, httptest.NewRequest(http.MethodGet, "/api/posts/recent", nil))
+	assert.Contains(t, privileged.Body.String(), "Family")
+}
+
+func TestGetPostBySlug(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	repo := &fakePostsRepository{
+		posts:    map[int]*post_models.Post{1: {PostId: 1, UserId: 7, Title: "New title", Content: "body", Slug: "new-title", Status: post_models.StatusPublished}},
+		oldSlugs: map[string]int{"old-title": 1},
+	}
+	api := New(repo, zap.NewNop(), markdown.NewRenderer(8))
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/posts/{id}/revisions", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("GET /api/p/{slug}", api.GetPostBySlug)
+
+	tests := []struct {
+		name             string
+		url              string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{name: "current slug", url: "/api/p/new-title", expectedStatus: http.StatusOK},
+		{name: "old slug", url: "/api/p/old-title", expectedStatus: http.StatusMovedPermanently, expectedLocation: "/api/p/new-title"},
+		{name: "unknown slug", url: "/api/p/nothing", expectedStatus: http.StatusNotFound},
+		{name: "not a post sub-resource", url: "/api/posts/1/revisionz", expectedStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			session.Manager.LoadAndSave(mux).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedLocation, rr.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package posts
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	post_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/posts"
+	"github.com/KylerJacobson/Go-Blog-API/internal/diff"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	v5 "github.com/jackc/pgx/v5"
+)
+
+func (postsApi *postsApi) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	post, _, err := postsApi.loadEditablePost(r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	revisions, err := postsApi.postsRepository.GetRevisions(post.PostId)
+	if err != nil {
+		postsApi.logger.Sugar().Errorf("error getting revisions of post %d : %v", post.PostId, err)
+		httperr.Write(w, httperr.Internal("failed to get revisions", ""))
+		return
+	}
+	if revisions == nil {
+		revisions = []post_models.Revision{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// DiffRevisions compares the revisions named by the from and to query parameters.
+func (postsApi *postsApi) DiffRevisions(w http.ResponseWriter, r *http.Request) {
+	post, _, err := postsApi.loadEditablePost(r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid revision", "from must be an integer"))
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid revision", "to must be an integer"))
+		return
+	}
+	fromRevision, err := postsApi.getRevision(post.PostId, from)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	toRevision, err := postsApi.getRevision(post.PostId, to)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(post_models.RevisionDiff{
+		From:              from,
+		To:                to,
+		Title:             diff.Lines(fromRevision.Title, toRevision.Title),
+		Content:           diff.Lines(fromRevision.Content, toRevision.Content),
+		RestrictedChanged: fromRevision.Restricted != toRevision.Restricted,
+	})
+}
+
+// RestoreRevision rolls a post back to an earlier revision. The restore is an
+// update of its own, so it is recorded as the newest revision.
+func (postsApi *postsApi) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	post, claims, err := postsApi.loadEditablePost(r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	rev, err := strconv.Atoi(r.PathValue("rev"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid revision", "revision must be an integer"))
+		return
+	}
+	revision, err := postsApi.getRevision(post.PostId, rev)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	restored, err := postsApi.postsRepository.UpdatePost(post_models.PostRequestBody{
+		Title:      revision.Title,
+		Content:    revision.Content,
+		Restricted: revision.Restricted,
+		Status:     post.Status,
+		PublishAt:  post.PublishAt,
+	}, post.PostId, claims.Sub)
+	if err != nil {
+		postsApi.logger.Sugar().Errorf("error restoring revision %d of post %d : %v", rev, post.PostId, err)
+		httperr.Write(w, httperr.Internal("failed to restore revision", ""))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(restored)
+}
+
+func (postsApi *postsApi) getRevision(postId, revision int) (*post_models.Revision, error) {
+	rev, err := postsApi.postsRepository.GetRevision(postId, revision)
+	if err != nil {
+		if errors.Is(err, v5.ErrNoRows) {
+			return nil, httperr.NotFound("Revision not found", "")
+		}
+		return nil, httperr.Internal("failed to get revision", "")
+	}
+	return rev, nil
+}
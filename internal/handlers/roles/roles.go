@@ -0,0 +1,120 @@
+package roles
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	roles_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/roles"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+)
+
+type RolesApi interface {
+	ListRoles(w http.ResponseWriter, r *http.Request)
+	SaveRole(w http.ResponseWriter, r *http.Request)
+	DeleteRole(w http.ResponseWriter, r *http.Request)
+}
+
+type rolesApi struct {
+	rolesRepository roles_repo.RolesRepository
+	logger          logger.Logger
+}
+
+func New(rolesRepo roles_repo.RolesRepository, logger logger.Logger) *rolesApi {
+	return &rolesApi{
+		rolesRepository: rolesRepo,
+		logger:          logger,
+	}
+}
+
+// Reload loads the custom roles from the database into rbac.
+func (rolesApi *rolesApi) Reload() error {
+	custom, err := rolesApi.rolesRepository.GetRoles()
+	if err != nil {
+		return err
+	}
+	rbac.SetCustomRoles(custom)
+	return nil
+}
+
+// ListRoles lists the built-in and custom roles with their permissions.
+func (rolesApi *rolesApi) ListRoles(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"roles":       rbac.Roles(),
+		"permissions": rbac.Permissions,
+	})
+}
+
+// SaveRole creates or replaces the custom role with the id in the path.
+// Built-in roles can't be changed.
+func (rolesApi *rolesApi) SaveRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid role id", "id must be an integer"))
+		return
+	}
+	var role rbac.Definition
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", err.Error()))
+		return
+	}
+	role.Id = rbac.Role(id)
+	role.Builtin = false
+	if err := rbac.Validate(role); err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid role", err.Error()))
+		return
+	}
+	if err := rolesApi.rolesRepository.SaveRole(role); err != nil {
+		if errors.Is(err, roles_repo.ErrDuplicateName) {
+			httperr.Write(w, httperr.New(http.StatusConflict, "Duplicate role name", err.Error()))
+			return
+		}
+		httperr.Write(w, httperr.Internal("failed to save role", ""))
+		return
+	}
+	rolesApi.reloadAfterChange()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(role)
+}
+
+// DeleteRole removes a custom role that no user has.
+func (rolesApi *rolesApi) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid role id", "id must be an integer"))
+		return
+	}
+	if rbac.Role(id) < rbac.FirstCustomRole {
+		httperr.Write(w, httperr.BadRequest("Invalid role", "built-in roles can't be deleted"))
+		return
+	}
+	deleted, err := rolesApi.rolesRepository.DeleteRole(rbac.Role(id))
+	if err != nil {
+		if errors.Is(err, roles_repo.ErrRoleInUse) {
+			httperr.Write(w, httperr.New(http.StatusConflict, "Role in use", "move its users to another role first"))
+			return
+		}
+		httperr.Write(w, httperr.Internal("failed to delete role", ""))
+		return
+	}
+	if !deleted {
+		httperr.Write(w, httperr.NotFound("Role not found", ""))
+		return
+	}
+	rolesApi.reloadAfterChange()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reloadAfterChange applies a change right away. If loading fails the change
+// is saved but only applies after the next successful reload.
+func (rolesApi *rolesApi) reloadAfterChange() {
+	if err := rolesApi.Reload(); err != nil {
+		rolesApi.logger.Sugar().Errorf("error reloading roles: %v", err)
+	}
+}
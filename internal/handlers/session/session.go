@@ -2,7 +2,6 @@ package session
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"os"
 	"strconv"
@@ -10,6 +9,7 @@ import (
 
 	"github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
 	users_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
 	"github.com/KylerJacobson/Go-Blog-API/logger"
 	"github.com/alexedwards/scs/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -18,8 +18,9 @@ import (
 var Manager *scs.SessionManager
 
 type UserClaim struct {
-	Sub  int `json:"sub"`
-	Role int `json:"role"`
+	Sub     int `json:"sub"`
+	Role    int `json:"role"`
+	Version int `json:"ver"`
 	jwt.RegisteredClaims
 }
 
@@ -72,27 +73,47 @@ func (sessionApi *sessionApi) CreateSession(w http.ResponseWriter, r *http.Reque
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
+	if user.PasswordResetRequired {
+		httperr.Write(w, httperr.New(http.StatusForbidden, "Password reset required", "an admin has asked you to choose a new password; use the forgotten password link to set one"))
+		return
+	}
+	if !user.EmailVerified {
+		httperr.Write(w, httperr.New(http.StatusForbidden, "Email not verified", "confirm your email address using the link we sent you before signing in"))
+		return
+	}
 
-	iId, _ := strconv.Atoi(user.Id)
+	ss, err := NewToken(user)
+	if err != nil {
+		sessionApi.logger.Sugar().Errorf("error signing session token for user %s : %v", user.Id, err)
+		httperr.Write(w, httperr.Internal("failed to create session", ""))
+		return
+	}
+	Manager.Put(r.Context(), "session_token", ss)
+	w.WriteHeader(http.StatusOK)
+	b, _ := json.Marshal(ss)
+	w.Write(b)
+	return
+}
 
+// NewToken signs a session token for the user. It carries the user's current
+// session version, so it stops working once their sessions are invalidated.
+func NewToken(user *users.User) (string, error) {
+	iId, _ := strconv.Atoi(user.Id)
+	now := time.Now()
 	claims := UserClaim{
-		iId,
-		user.Role,
-		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+		Sub:     iId,
+		Role:    user.Role,
+		Version: user.SessionVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
 			Issuer:    "kylerjacobson.dev",
 		},
 	}
 
 	// Sign and get the complete encoded token as a string using the secret
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	ss, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	fmt.Println(ss, err)
-	Manager.Put(r.Context(), "session_token", ss)
-	w.WriteHeader(http.StatusOK)
-	b, _ := json.Marshal(ss)
-	w.Write(b)
-	return
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
 }
 
 func (sessionApi *sessionApi) DeleteSession(w http.ResponseWriter, r *http.Request) {
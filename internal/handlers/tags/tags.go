@@ -0,0 +1,47 @@
+package tags
+
+import (
+	"encoding/json"
+	"net/http"
+
+	tag_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/tags"
+	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
+	tags_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/tags"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+)
+
+type TagsApi interface {
+	GetTags(w http.ResponseWriter, r *http.Request)
+}
+
+type tagsApi struct {
+	tagsRepository tags_repo.TagsRepository
+	logger         logger.Logger
+}
+
+func New(tagsRepo tags_repo.TagsRepository, logger logger.Logger) *tagsApi {
+	return &tagsApi{
+		tagsRepository: tagsRepo,
+		logger:         logger,
+	}
+}
+
+// GetTags returns the tags with their post counts. Posts the session may not
+// read are left out of the counts.
+func (tagsApi *tagsApi) GetTags(w http.ResponseWriter, r *http.Request) {
+	token := session.Manager.GetString(r.Context(), "session_token")
+	tags, err := tagsApi.tagsRepository.GetTags(authorization.CheckPrivilege(r.Context(), token))
+	if err != nil {
+		tagsApi.logger.Sugar().Errorf("error getting tags : %v", err)
+		httperr.Write(w, httperr.Internal("failed to get tags", ""))
+		return
+	}
+	if tags == nil {
+		tags = []tag_models.Tag{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tags)
+}
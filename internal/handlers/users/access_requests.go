@@ -0,0 +1,121 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
+	users_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/mailer"
+	pgxv5 "github.com/jackc/pgx/v5"
+)
+
+// ListAccessRequests lists access requests, pending ones unless the status
+// query parameter asks for approved, denied or all.
+func (usersApi *usersApi) ListAccessRequests(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = "pending"
+	case "all":
+		status = ""
+	case "pending", "approved", "denied":
+	default:
+		httperr.Write(w, httperr.BadRequest("Invalid status", "status must be pending, approved, denied or all"))
+		return
+	}
+	requests, err := usersApi.usersRepository.ListAccessRequests(status)
+	if err != nil {
+		httperr.Write(w, httperr.Internal("failed to list access requests", ""))
+		return
+	}
+	if requests == nil {
+		requests = []users.AccessRequest{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(requests)
+}
+
+// ApproveAccessRequest grants the requested role. The body may give a reason,
+// which is passed on to the requester.
+func (usersApi *usersApi) ApproveAccessRequest(w http.ResponseWriter, r *http.Request) {
+	usersApi.decideAccessRequest(w, r, true)
+}
+
+// DenyAccessRequest refuses the requested role. The body must give a reason,
+// which is passed on to the requester.
+func (usersApi *usersApi) DenyAccessRequest(w http.ResponseWriter, r *http.Request) {
+	usersApi.decideAccessRequest(w, r, false)
+}
+
+func (usersApi *usersApi) decideAccessRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	requestId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid access request id", "id must be an integer"))
+		return
+	}
+	var decision users.AccessRequestDecision
+	if err := json.NewDecoder(r.Body).Decode(&decision); err != nil && !errors.Is(err, io.EOF) {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", err.Error()))
+		return
+	}
+	decision.Reason = strings.TrimSpace(decision.Reason)
+	if !approve && decision.Reason == "" {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", "a reason is required to deny a request"))
+		return
+	}
+	claims := authorization.RequestClaims(r.Context(), session.Manager.GetString(r.Context(), "session_token"))
+	if claims == nil {
+		httperr.Write(w, httperr.New(http.StatusUnauthorized, "Unauthorized", "You must be logged in to decide access requests"))
+		return
+	}
+
+	request, err := usersApi.usersRepository.DecideAccessRequest(requestId, approve, decision.Reason, claims.Sub)
+	if err != nil {
+		if errors.Is(err, pgxv5.ErrNoRows) {
+			httperr.Write(w, httperr.NotFound("Access request not found", ""))
+			return
+		}
+		if errors.Is(err, users_repo.ErrAccessRequestDecided) {
+			httperr.Write(w, httperr.New(http.StatusConflict, "Access request already decided", ""))
+			return
+		}
+		httperr.Write(w, httperr.Internal("failed to decide access request", ""))
+		return
+	}
+
+	go func() {
+		if err := usersApi.mailer.Send(context.WithoutCancel(r.Context()), accessDecisionMessage(*request)); err != nil {
+			usersApi.logger.Sugar().Errorf("error notifying user %d of access request %d: %v", request.UserId, request.RequestId, err)
+		}
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(request)
+}
+
+func accessDecisionMessage(request users.AccessRequest) mailer.Message {
+	var body strings.Builder
+	fmt.Fprintf(&body, "Hi %s,\n\n", request.FirstName)
+	subject := "Your access request was approved"
+	if request.Status == "approved" {
+		body.WriteString("Your request for access to restricted posts has been approved. Sign in again to see them.\n")
+	} else {
+		subject = "Your access request was denied"
+		body.WriteString("Your request for access to restricted posts has been denied.\n")
+	}
+	if request.Reason != nil {
+		fmt.Fprintf(&body, "\nReason: %s\n", *request.Reason)
+	}
+	return mailer.Message{To: request.Email, Subject: subject, Body: body.String()}
+}
@@ -0,0 +1,71 @@
+package users
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	userModels "github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	users_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/golang-jwt/jwt/v5"
+	pgxv5 "github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDecideAccessRequest(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	adminToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": 1, "role": 1}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	reason := "not a family member"
+	mockRepo := new(mockUsersRepository)
+	mockRepo.On("DecideAccessRequest", 3, false, reason, 1).Return(&userModels.AccessRequest{RequestId: 3, UserId: 9, Status: "denied", Reason: &reason}, nil)
+	mockRepo.On("DecideAccessRequest", 3, true, "", 1).Return(nil, users_repo.ErrAccessRequestDecided)
+	mockRepo.On("DecideAccessRequest", 4, true, "", 1).Return(nil, pgxv5.ErrNoRows)
+	api := New(mockRepo, zap.NewNop(), &fakeMailer{}, Config{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/access-requests/{id}/approve", api.ApproveAccessRequest)
+	mux.HandleFunc("POST /api/access-requests/{id}/deny", api.DenyAccessRequest)
+	handler := session.Manager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session.Manager.Put(r.Context(), "session_token", adminToken)
+		mux.ServeHTTP(w, r)
+	}))
+
+	tests := []struct {
+		name           string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{name: "deny with a reason", url: "/api/access-requests/3/deny", body: `{"reason": " not a family member "}`, expectedStatus: http.StatusOK},
+		{name: "deny without a reason", url: "/api/access-requests/3/deny", body: `{}`, expectedStatus: http.StatusBadRequest},
+		{name: "approve without a body", url: "/api/access-requests/3/approve", expectedStatus: http.StatusConflict},
+		{name: "unknown request", url: "/api/access-requests/4/approve", body: `{}`, expectedStatus: http.StatusNotFound},
+		{name: "bad id", url: "/api/access-requests/abc/approve", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestAccessDecisionMessage(t *testing.T) {
+	reason := "welcome"
+	message := accessDecisionMessage(userModels.AccessRequest{FirstName: "Jane", Email: "jane@test.com", Status: "approved", Reason: &reason})
+	assert.Equal(t, "jane@test.com", message.To)
+	assert.Equal(t, "Your access request was approved", message.Subject)
+	assert.Contains(t, message.Body, "Reason: welcome")
+
+	message = accessDecisionMessage(userModels.AccessRequest{Status: "denied"})
+	assert.Equal(t, "Your access request was denied", message.Subject)
+	assert.NotContains(t, message.Body, "Reason")
+}
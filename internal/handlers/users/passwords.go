@@ -0,0 +1,103 @@
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+)
+
+// ChangePassword sets a new password for the signed in user, who must confirm
+// their current one. Every other session of the user is signed out and any
+// reset links stop working; the session making the change gets a new token.
+func (usersApi *usersApi) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid user id", "id must be an integer"))
+		return
+	}
+	claims := authorization.RequestClaims(r.Context(), session.Manager.GetString(r.Context(), "session_token"))
+	if claims == nil {
+		httperr.Write(w, httperr.New(http.StatusUnauthorized, "Unauthorized", "You must be logged in to change your password"))
+		return
+	}
+	if claims.Sub != userId {
+		httperr.Write(w, httperr.New(http.StatusForbidden, "Forbidden", "You can only change your own password"))
+		return
+	}
+	var change users.PasswordChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", err.Error()))
+		return
+	}
+	if change.CurrentPassword == "" {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", "current password is required"))
+		return
+	}
+	if err := usersApi.config.PasswordPolicy.Check(change.NewPassword); err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", err.Error()))
+		return
+	}
+	if change.NewPassword == change.CurrentPassword {
+		httperr.Write(w, httperr.BadRequest("Invalid request body", "new password must be different from the current one"))
+		return
+	}
+
+	user, err := usersApi.usersRepository.ChangePassword(userId, change.CurrentPassword, change.NewPassword)
+	if err != nil {
+		httperr.Write(w, httperr.Internal("failed to change password", ""))
+		return
+	}
+	if user == nil {
+		httperr.Write(w, httperr.New(http.StatusForbidden, "Incorrect password", "the current password is wrong"))
+		return
+	}
+
+	token, err := session.NewToken(user)
+	if err != nil {
+		// The password has changed and the old token no longer works, so the
+		// user has to sign in again.
+		usersApi.logger.Sugar().Errorf("error signing session token for user %d : %v", userId, err)
+		httperr.Write(w, httperr.Internal("password changed, but failed to renew the session", "sign in again with the new password"))
+		return
+	}
+	if err := session.Manager.RenewToken(r.Context()); err != nil {
+		usersApi.logger.Sugar().Errorf("error renewing session of user %d : %v", userId, err)
+	}
+	session.Manager.Put(r.Context(), "session_token", token)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForcePasswordReset lets an admin sign a user out everywhere and make them
+// choose a new password, using a reset email, before they can sign in again.
+func (usersApi *usersApi) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid user id", "id must be an integer"))
+		return
+	}
+	claims := authorization.RequestClaims(r.Context(), session.Manager.GetString(r.Context(), "session_token"))
+	if claims == nil {
+		httperr.Write(w, httperr.New(http.StatusUnauthorized, "Unauthorized", "You are not authorized to access this resource"))
+		return
+	}
+	if claims.Sub == userId {
+		httperr.Write(w, httperr.BadRequest("Invalid user", "change your own password instead"))
+		return
+	}
+	found, err := usersApi.usersRepository.RequirePasswordReset(userId)
+	if err != nil {
+		httperr.Write(w, httperr.Internal("failed to require a password reset", ""))
+		return
+	}
+	if !found {
+		httperr.Write(w, httperr.NotFound("User not found", ""))
+		return
+	}
+	usersApi.logger.Sugar().Infof("user %d required user %d to reset their password", claims.Sub, userId)
+	w.WriteHeader(http.StatusNoContent)
+}
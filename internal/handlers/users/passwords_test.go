@@ -0,0 +1,65 @@
+package users
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	userModels "github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/password"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestChangePassword(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	userToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": 7, "role": 0}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	mockRepo := new(mockUsersRepository)
+	mockRepo.On("ChangePassword", 7, "old-password", "New-password-1").Return(&userModels.User{Id: "7", SessionVersion: 1}, nil)
+	mockRepo.On("ChangePassword", 7, "wrong-password", "New-password-1").Return(nil, nil)
+	api := New(mockRepo, zap.NewNop(), &fakeMailer{}, Config{PasswordPolicy: password.Policy{MinLength: 10, RequireDigit: true}})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /api/user/{id}/password", api.ChangePassword)
+	var renewed string
+	handler := session.Manager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session.Manager.Put(r.Context(), "session_token", userToken)
+		mux.ServeHTTP(w, r)
+		renewed = session.Manager.GetString(r.Context(), "session_token")
+	}))
+
+	tests := []struct {
+		name           string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{name: "changed", url: "/api/user/7/password", body: `{"currentPassword": "old-password", "newPassword": "New-password-1"}`, expectedStatus: http.StatusNoContent},
+		{name: "wrong current password", url: "/api/user/7/password", body: `{"currentPassword": "wrong-password", "newPassword": "New-password-1"}`, expectedStatus: http.StatusForbidden},
+		{name: "missing current password", url: "/api/user/7/password", body: `{"newPassword": "New-password-1"}`, expectedStatus: http.StatusBadRequest},
+		{name: "weak new password", url: "/api/user/7/password", body: `{"currentPassword": "old-password", "newPassword": "no-digits-here"}`, expectedStatus: http.StatusBadRequest},
+		{name: "unchanged password", url: "/api/user/7/password", body: `{"currentPassword": "Same-password-1", "newPassword": "Same-password-1"}`, expectedStatus: http.StatusBadRequest},
+		{name: "another user", url: "/api/user/8/password", body: `{"currentPassword": "old-password", "newPassword": "New-password-1"}`, expectedStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, tt.url, strings.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus == http.StatusNoContent {
+				claims := authorization.DecodeToken(renewed)
+				if assert.NotNil(t, claims, "the session continues with a new token") {
+					assert.Equal(t, 1, claims.Version)
+				}
+			}
+		})
+	}
+}
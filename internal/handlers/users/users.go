@@ -1,6 +1,7 @@
 package users
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,12 +9,16 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
 	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
 	users_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/users"
 	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
 	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/password"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/mailer"
 	pgxv5 "github.com/jackc/pgx/v5"
 )
 
@@ -25,17 +30,41 @@ type UsersApi interface {
 	DeleteUserById(w http.ResponseWriter, r *http.Request)
 	LoginUser(w http.ResponseWriter, r *http.Request)
 	GetUserFromSession(w http.ResponseWriter, r *http.Request)
+	VerifyEmail(w http.ResponseWriter, r *http.Request)
+	ResendVerification(w http.ResponseWriter, r *http.Request)
+	ForceVerify(w http.ResponseWriter, r *http.Request)
+	ListAccessRequests(w http.ResponseWriter, r *http.Request)
+	ApproveAccessRequest(w http.ResponseWriter, r *http.Request)
+	DenyAccessRequest(w http.ResponseWriter, r *http.Request)
+	ChangePassword(w http.ResponseWriter, r *http.Request)
+	ForcePasswordReset(w http.ResponseWriter, r *http.Request)
+}
+
+// Config holds the user account settings that come from the environment.
+type Config struct {
+	// VerifyURL is where verification links point, normally the
+	// GET /api/user/verify endpoint. The token is added as the token query
+	// parameter.
+	VerifyURL string
+	// VerificationTTL is how long a verification link stays valid.
+	VerificationTTL time.Duration
+	// PasswordPolicy is the strength new passwords must have.
+	PasswordPolicy password.Policy
 }
 
 type usersApi struct {
 	usersRepository users_repo.UsersRepository
 	logger          logger.Logger
+	mailer          mailer.Mailer
+	config          Config
 }
 
-func New(usersRepo users_repo.UsersRepository, logger logger.Logger) *usersApi {
+func New(usersRepo users_repo.UsersRepository, logger logger.Logger, mailer mailer.Mailer, config Config) *usersApi {
 	return &usersApi{
 		usersRepository: usersRepo,
 		logger:          logger,
+		mailer:          mailer,
+		config:          config,
 	}
 }
 
@@ -108,7 +137,7 @@ func (usersApi *usersApi) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = validateCreateUserRequest(accountCreationRequest.User)
+	err = validateCreateUserRequest(accountCreationRequest.User, usersApi.config.PasswordPolicy)
 	if err != nil {
 		usersApi.logger.Sugar().Errorf("error validating user create request", err)
 		httperr.Write(w, httperr.BadRequest("Invalid request body", err.Error()))
@@ -121,6 +150,14 @@ func (usersApi *usersApi) CreateUser(w http.ResponseWriter, r *http.Request) {
 		httperr.Write(w, httperr.New(http.StatusInternalServerError, "failed to create user", ""))
 		return
 	}
+	// The account can't sign in until the address is confirmed. A failed email
+	// doesn't fail the sign up, as an admin can resend it.
+	newUser := users.User{Id: userId, FirstName: accountCreationRequest.User.FirstName, Email: accountCreationRequest.User.Email}
+	go func() {
+		if err := usersApi.sendVerification(context.WithoutCancel(r.Context()), newUser); err != nil {
+			usersApi.logger.Sugar().Errorf("error sending verification email to user %s: %v", userId, err)
+		}
+	}()
 
 	w.WriteHeader(http.StatusOK)
 	// Set content header to application/json
@@ -132,7 +169,7 @@ func (usersApi *usersApi) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 // create a function to validate the request body on create user
 
-func validateCreateUserRequest(userRequest users.UserCreate) error {
+func validateCreateUserRequest(userRequest users.UserCreate, passwordPolicy password.Policy) error {
 	var errors []string
 	if userRequest.FirstName == "" {
 		errors = append(errors, "first name is required")
@@ -146,8 +183,8 @@ func validateCreateUserRequest(userRequest users.UserCreate) error {
 	if userRequest.Password == "" {
 		errors = append(errors, "password is required")
 	}
-	if len(userRequest.Password) < 8 {
-		errors = append(errors, "password must be at least 8 characters long")
+	if err := passwordPolicy.Check(userRequest.Password); err != nil {
+		errors = append(errors, err.Error())
 	}
 	if strings.Contains(userRequest.Email, "@") == false {
 		errors = append(errors, "invalid email format")
@@ -233,6 +270,11 @@ func (usersApi *usersApi) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	// validate user update request
 	err = usersApi.validateUpdateUserRequest(r, userUpdate)
+	var httpErr *httperr.Error
+	if errors.As(err, &httpErr) {
+		httperr.Write(w, err)
+		return
+	}
 	if err != nil {
 		usersApi.logger.Sugar().Errorf("error validating user update request: %v", err)
 		w.WriteHeader(http.StatusBadRequest)
@@ -241,7 +283,7 @@ func (usersApi *usersApi) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = usersApi.usersRepository.UpdateUser(userUpdate)
+	emailChanged, err := usersApi.usersRepository.UpdateUser(userUpdate)
 	if err != nil {
 		if errors.Is(err, pgxv5.ErrNoRows) {
 			usersApi.logger.Sugar().Infof("User with id: %s does not exist in the database", userUpdate.Id)
@@ -253,6 +295,15 @@ func (usersApi *usersApi) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		w.Write(b)
 		return
 	}
+	// The new address has to be confirmed before the user can sign in again.
+	if emailChanged {
+		changedUser := users.User{Id: userUpdate.Id, FirstName: userUpdate.FirstName, Email: userUpdate.Email}
+		go func() {
+			if err := usersApi.sendVerification(context.WithoutCancel(r.Context()), changedUser); err != nil {
+				usersApi.logger.Sugar().Errorf("error sending verification email to user %s: %v", changedUser.Id, err)
+			}
+		}()
+	}
 	w.WriteHeader(http.StatusNoContent)
 
 }
@@ -266,9 +317,13 @@ func (usersApi *usersApi) GetUserFromSession(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	token := session.Manager.GetString(r.Context(), "session_token")
-	fmt.Println(token)
-	claims := authorization.DecodeToken(token)
-	fmt.Println(claims)
+	claims := authorization.RequestClaims(r.Context(), token)
+	// Expired tokens, and those signed out by a password change, count as not
+	// logged in.
+	if claims == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 	user, err := usersApi.usersRepository.GetUserById(claims.Sub)
 	if err != nil {
 		if errors.Is(err, pgxv5.ErrNoRows) {
@@ -308,20 +363,26 @@ func (usersApi *usersApi) validateUpdateUserRequest(r *http.Request, userUpdate
 		errors = append(errors, err)
 	}
 	token := session.Manager.GetString(r.Context(), "session_token")
-	claims := authorization.DecodeToken(token)
-	if claims.Sub != userID && claims.Role != 1 {
+	claims := authorization.RequestClaims(r.Context(), token)
+	if claims == nil {
+		return fmt.Errorf("validation failed")
+	}
+	if userUpdate.Id != id {
+		errors = append(errors, fmt.Errorf("id in the body must match the path"))
+	}
+	if claims.Sub != userID && !authorization.HasPermission(claims, rbac.UserManage) {
 		usersApi.logger.Sugar().Errorf("user %d attempted to update user %d", claims.Sub, userID)
 		errors = append(errors, err)
 	}
 
 	// Validate permission escalation / deescalation
-	if claims.Sub == 1 && userID == 1 && userUpdate.Role != 1 {
-		usersApi.logger.Sugar().Errorf("user is already an admin, cannot decrease permission: %v", err)
-		errors = append(errors, err)
+	role := rbac.Role(userUpdate.Role)
+	if claims.Sub == userID && claims.Role == rbac.RoleAdmin && role != rbac.RoleAdmin {
+		usersApi.logger.Sugar().Errorf("admin %d cannot remove their own admin role", claims.Sub)
+		errors = append(errors, fmt.Errorf("admins cannot remove their own admin role"))
 	}
-	if claims.Role != 1 && userUpdate.Role == 1 {
-		usersApi.logger.Sugar().Errorf("access denied: %v", err)
-		errors = append(errors, err)
+	if !rbac.Exists(role) {
+		errors = append(errors, fmt.Errorf("unknown role %d", role))
 	}
 
 	// Validate fields
@@ -338,5 +399,20 @@ func (usersApi *usersApi) validateUpdateUserRequest(r *http.Request, userUpdate
 	if len(errors) > 0 {
 		return fmt.Errorf("validation failed")
 	}
+
+	// The role is always written, so whether it changes has to be known
+	// before the update is allowed.
+	current, err := usersApi.usersRepository.GetUserById(userID)
+	if err != nil {
+		usersApi.logger.Sugar().Errorf("error getting user %d to check their role: %v", userID, err)
+		return httperr.Internal("failed to get user", "")
+	}
+	if current == nil {
+		return httperr.NotFound("User not found", "")
+	}
+	if current.Role != userUpdate.Role && !authorization.HasPermission(claims, rbac.UserAssignRole) {
+		usersApi.logger.Sugar().Errorf("access denied: user %d may not change the role of user %d", claims.Sub, userID)
+		return fmt.Errorf("access denied")
+	}
 	return nil
 }
@@ -5,26 +5,30 @@ import (
 	"encoding/json"
 	"errors"
 	userModels "github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/mailer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 type mockUsersRepository struct {
 	mock.Mock
 }
 
-func (m *mockUsersRepository) UpdateUser(user userModels.UserUpdate) error {
-	//TODO implement me
-	panic("implement me")
+func (m *mockUsersRepository) UpdateUser(user userModels.UserUpdate) (bool, error) {
+	args := m.Called(user)
+	return args.Bool(0), args.Error(1)
 }
 
 func (m *mockUsersRepository) GetUserById(id int) (*userModels.User, error) {
-	//TODO implement me
-	panic("implement me")
+	args := m.Called(id)
+	user, _ := args.Get(0).(*userModels.User)
+	return user, args.Error(1)
 }
 
 func (m *mockUsersRepository) GetUserByEmail(email string) (*userModels.User, error) {
@@ -47,6 +51,48 @@ func (m *mockUsersRepository) LoginUser(user userModels.UserLogin) (*userModels.
 	panic("implement me")
 }
 
+func (m *mockUsersRepository) CreatePasswordReset(userId int, tokenHash string, expiresAt time.Time) error {
+	//TODO implement me
+	panic("implement me")
+}
+
+func (m *mockUsersRepository) ResetPassword(tokenHash string, password string) (bool, error) {
+	//TODO implement me
+	panic("implement me")
+}
+
+func (m *mockUsersRepository) VerifyEmail(userId int, email string) (bool, error) {
+	args := m.Called(userId, email)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockUsersRepository) ListAccessRequests(status string) ([]userModels.AccessRequest, error) {
+	//TODO implement me
+	panic("implement me")
+}
+
+func (m *mockUsersRepository) DecideAccessRequest(requestId int, approve bool, reason string, decidedBy int) (*userModels.AccessRequest, error) {
+	args := m.Called(requestId, approve, reason, decidedBy)
+	request, _ := args.Get(0).(*userModels.AccessRequest)
+	return request, args.Error(1)
+}
+
+func (m *mockUsersRepository) ChangePassword(userId int, currentPassword string, newPassword string) (*userModels.User, error) {
+	args := m.Called(userId, currentPassword, newPassword)
+	user, _ := args.Get(0).(*userModels.User)
+	return user, args.Error(1)
+}
+
+func (m *mockUsersRepository) RequirePasswordReset(userId int) (bool, error) {
+	//TODO implement me
+	panic("implement me")
+}
+
+func (m *mockUsersRepository) GetSessionState(userId int) (rbac.Role, int, error) {
+	//TODO implement me
+	panic("implement me")
+}
+
 func (m *mockUsersRepository) CreateUser(user userModels.UserCreate) (string, error) {
 	args := m.Called(user)
 	return args.Get(0).(string), args.Error(1)
@@ -180,7 +226,7 @@ func TestCreateUser(t *testing.T) {
 			}
 
 			// Create API instance
-			usersApi := New(mockRepo, testLogger)
+			usersApi := New(mockRepo, testLogger, mailer.NewLogMailer(testLogger), Config{})
 
 			// Create request body
 			var bodyBytes []byte
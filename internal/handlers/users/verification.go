@@ -0,0 +1,153 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/mailer"
+	"github.com/golang-jwt/jwt/v5"
+	pgxv5 "github.com/jackc/pgx/v5"
+)
+
+// verificationAudience keeps verification tokens from being accepted where a
+// session token is expected, and the other way around.
+const verificationAudience = "email-verification"
+
+// verificationClaim is signed into verification links. It names the address
+// being verified, so a link stops working if the user changes their email.
+type verificationClaim struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// VerifyEmail confirms an email address using the token from a verification
+// link.
+func (usersApi *usersApi) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	claims, err := parseVerificationToken(r.URL.Query().Get("token"))
+	if err != nil {
+		usersApi.logger.Sugar().Infof("invalid verification token: %v", err)
+		httperr.Write(w, httperr.BadRequest("Invalid or expired verification link", "ask for a new verification email"))
+		return
+	}
+	userId, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		httperr.Write(w, httperr.BadRequest("Invalid or expired verification link", "ask for a new verification email"))
+		return
+	}
+	verified, err := usersApi.usersRepository.VerifyEmail(userId, claims.Email)
+	if err != nil {
+		httperr.Write(w, httperr.Internal("failed to verify email", ""))
+		return
+	}
+	if !verified {
+		httperr.Write(w, httperr.BadRequest("Invalid or expired verification link", "the account's email address has changed"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Email address verified",
+	})
+}
+
+// ResendVerification lets an admin send a user a new verification email.
+func (usersApi *usersApi) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, err := usersApi.userFromPath(r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	if user.EmailVerified {
+		httperr.Write(w, httperr.New(http.StatusConflict, "Email already verified", ""))
+		return
+	}
+	if err := usersApi.sendVerification(r.Context(), *user); err != nil {
+		usersApi.logger.Sugar().Errorf("error sending verification email to user %s: %v", user.Id, err)
+		httperr.Write(w, httperr.Internal("failed to send verification email", ""))
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ForceVerify lets an admin mark a user's email address verified without a
+// verification link.
+func (usersApi *usersApi) ForceVerify(w http.ResponseWriter, r *http.Request) {
+	user, err := usersApi.userFromPath(r)
+	if err != nil {
+		httperr.Write(w, err)
+		return
+	}
+	userId, _ := strconv.Atoi(user.Id)
+	if _, err := usersApi.usersRepository.VerifyEmail(userId, user.Email); err != nil {
+		httperr.Write(w, httperr.Internal("failed to verify email", ""))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (usersApi *usersApi) userFromPath(r *http.Request) (*users.User, error) {
+	userId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return nil, httperr.BadRequest("Invalid user id", "id must be an integer")
+	}
+	user, err := usersApi.usersRepository.GetUserById(userId)
+	if err != nil {
+		if errors.Is(err, pgxv5.ErrNoRows) {
+			return nil, httperr.NotFound("User not found", "")
+		}
+		return nil, httperr.Internal("failed to get user", "")
+	}
+	if user == nil {
+		return nil, httperr.NotFound("User not found", "")
+	}
+	return user, nil
+}
+
+// sendVerification emails the user a link that verifies their address.
+func (usersApi *usersApi) sendVerification(ctx context.Context, user users.User) error {
+	now := time.Now()
+	claims := verificationClaim{
+		Email: user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.Id,
+			Audience:  jwt.ClaimStrings{verificationAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(usersApi.config.VerificationTTL)),
+			Issuer:    "kylerjacobson.dev",
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	if err != nil {
+		return err
+	}
+	link := usersApi.config.VerifyURL + "?token=" + url.QueryEscape(token)
+	return usersApi.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link within %s:\n\n%s\n\nYou can sign in once your address is confirmed. If you didn't create an account, you can ignore this email.\n",
+			user.FirstName, usersApi.config.VerificationTTL, link),
+	})
+}
+
+func parseVerificationToken(token string) (*verificationClaim, error) {
+	if token == "" {
+		return nil, errors.New("token is missing")
+	}
+	claims := &verificationClaim{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	}, jwt.WithAudience(verificationAudience), jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,148 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	userModels "github.com/KylerJacobson/Go-Blog-API/internal/api/types/users"
+	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/mailer"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
+)
+
+type fakeMailer struct {
+	sent []mailer.Message
+}
+
+func (f *fakeMailer) Send(ctx context.Context, message mailer.Message) error {
+	f.sent = append(f.sent, message)
+	return nil
+}
+
+// chanMailer hands each message to a channel, for mail sent in the background.
+type chanMailer chan mailer.Message
+
+func (c chanMailer) Send(ctx context.Context, message mailer.Message) error {
+	c <- message
+	return nil
+}
+
+func TestUpdateUserEmailChange(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	userToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": 7, "role": 0}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	mockRepo := new(mockUsersRepository)
+	mockRepo.On("GetUserById", 7).Return(&userModels.User{Id: "7", Email: "jane@test.com", EmailVerified: true}, nil)
+	mockRepo.On("UpdateUser", userModels.UserUpdate{Id: "7", FirstName: "Jane", LastName: "Doe", Email: "jane@test.com"}).Return(false, nil)
+	mockRepo.On("UpdateUser", userModels.UserUpdate{Id: "7", FirstName: "Jane", LastName: "Doe", Email: "jane@elsewhere.com"}).Return(true, nil)
+	mail := make(chanMailer, 1)
+	api := New(mockRepo, zap.NewNop(), mail, Config{VerifyURL: "https://example.com/api/user/verify", VerificationTTL: time.Hour})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /api/user/{id}", api.UpdateUser)
+	handler := session.Manager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session.Manager.Put(r.Context(), "session_token", userToken)
+		mux.ServeHTTP(w, r)
+	}))
+	update := func(email string) int {
+		body := `{"id": "7", "firstName": "Jane", "lastName": "Doe", "email": "` + email + `", "role": 0}`
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/api/user/7", strings.NewReader(body)))
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusNoContent, update("jane@test.com"))
+	assert.Equal(t, http.StatusNoContent, update("jane@elsewhere.com"))
+	select {
+	case message := <-mail:
+		assert.Equal(t, "jane@elsewhere.com", message.To)
+	case <-time.After(time.Second):
+		t.Fatal("no verification email was sent for the new address")
+	}
+	assert.Empty(t, mail, "an unchanged address isn't verified again")
+}
+
+func TestUpdateUserRoleCheckFailsClosed(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	session.Init()
+	userToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": 7, "role": 0}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		current        *userModels.User
+		lookupErr      error
+		expectedStatus int
+	}{
+		{name: "lookup fails", lookupErr: errors.New("connection refused"), expectedStatus: http.StatusInternalServerError},
+		{name: "user missing", expectedStatus: http.StatusNotFound},
+		{name: "role changed without permission", current: &userModels.User{Id: "7", Role: 0}, expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(mockUsersRepository)
+			mockRepo.On("GetUserById", 7).Return(tt.current, tt.lookupErr)
+			api := New(mockRepo, zap.NewNop(), &fakeMailer{}, Config{})
+			mux := http.NewServeMux()
+			mux.HandleFunc("PUT /api/user/{id}", api.UpdateUser)
+
+			body := `{"id": "7", "firstName": "Jane", "lastName": "Doe", "email": "jane@test.com", "role": 1}`
+			rr := httptest.NewRecorder()
+			session.Manager.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				session.Manager.Put(r.Context(), "session_token", userToken)
+				mux.ServeHTTP(w, r)
+			})).ServeHTTP(rr, httptest.NewRequest(http.MethodPut, "/api/user/7", strings.NewReader(body)))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			mockRepo.AssertNotCalled(t, "UpdateUser", mock.Anything)
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	t.Setenv("JWT_SECRET", "secret")
+	mockRepo := new(mockUsersRepository)
+	mockRepo.On("VerifyEmail", 7, "jane@test.com").Return(true, nil)
+	mail := &fakeMailer{}
+	api := New(mockRepo, zap.NewNop(), mail, Config{VerifyURL: "https://example.com/api/user/verify", VerificationTTL: time.Hour})
+
+	assert.NoError(t, api.sendVerification(context.Background(), userModels.User{Id: "7", FirstName: "Jane", Email: "jane@test.com"}))
+	assert.Len(t, mail.sent, 1)
+	link, err := url.Parse(regexp.MustCompile(`https://\S+`).FindString(mail.sent[0].Body))
+	assert.NoError(t, err)
+
+	sessionToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": 7, "role": 1}).SignedString([]byte("secret"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "valid link", token: link.Query().Get("token"), expectedStatus: http.StatusOK},
+		{name: "missing token", token: "", expectedStatus: http.StatusBadRequest},
+		{name: "session token", token: sessionToken, expectedStatus: http.StatusBadRequest},
+		{name: "tampered token", token: link.Query().Get("token") + "x", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/verify?token="+url.QueryEscape(tt.token), nil)
+			rr := httptest.NewRecorder()
+			api.VerifyEmail(rr, req)
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+	mockRepo.AssertNumberOfCalls(t, "VerifyEmail", 1)
+}
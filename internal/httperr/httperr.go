@@ -11,6 +11,9 @@ type Error struct {
 	Status  int    `json:"status"`
 	Message string `json:"message"`
 	Detail  string `json:"detail,omitempty"`
+	// Errors holds the individual failures when a request acts on several
+	// items, such as a batch of uploaded files.
+	Errors []*Error `json:"errors,omitempty"`
 }
 
 // Error implements the error interface
@@ -40,6 +43,29 @@ func Internal(message string, detail string) *Error {
 	return New(http.StatusInternalServerError, message, detail)
 }
 
+func UnsupportedMediaType(message string, detail string) *Error {
+	return New(http.StatusUnsupportedMediaType, message, detail)
+}
+
+func TooLarge(message string, detail string) *Error {
+	return New(http.StatusRequestEntityTooLarge, message, detail)
+}
+
+// Batch combines the failures of a request that acts on several items. It
+// takes their status when they all share one, and 400 otherwise.
+func Batch(message string, errs []*Error) *Error {
+	status := http.StatusBadRequest
+	for i, err := range errs {
+		if i == 0 {
+			status = err.Status
+		} else if err.Status != status {
+			status = http.StatusBadRequest
+			break
+		}
+	}
+	return &Error{Status: status, Message: message, Errors: errs}
+}
+
 // Write sends the error response to the http.ResponseWriter
 func Write(w http.ResponseWriter, err error) {
 	var httpErr *Error
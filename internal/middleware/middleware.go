@@ -4,22 +4,34 @@ import (
 	"github.com/KylerJacobson/Go-Blog-API/internal/authorization"
 	"github.com/KylerJacobson/Go-Blog-API/internal/handlers/session"
 	"github.com/KylerJacobson/Go-Blog-API/internal/httperr"
+	"github.com/KylerJacobson/Go-Blog-API/internal/rbac"
 	"net/http"
 )
 
-func AuthAdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Check session to see if user is logged in
-		if !session.Manager.Exists(r.Context(), "session_token") {
-			httperr.Write(w, httperr.New(http.StatusUnauthorized, "Unauthorized", "You are not authorized to access this resource"))
-			return
+// RequirePermission only lets through sessions whose role grants perm.
+// Requests without a session get a 401 and those lacking perm a 403.
+func RequirePermission(perm rbac.Permission) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := requireSession(w, r)
+			if !ok {
+				return
+			}
+			if !authorization.HasPermission(claims, perm) {
+				httperr.Write(w, httperr.New(http.StatusForbidden, "Unauthorized", "You are not authorized to access this resource"))
+				return
+			}
+			next(w, r)
 		}
-		token := session.Manager.GetString(r.Context(), "session_token")
-		claims := authorization.DecodeToken(token)
-		if claims.Role != 1 {
-			httperr.Write(w, httperr.New(http.StatusForbidden, "Unauthorized", "You are not authorized to access this resource"))
-			return
-		}
-		next(w, r)
 	}
 }
+
+func requireSession(w http.ResponseWriter, r *http.Request) (*authorization.UserClaim, bool) {
+	// Check session to see if user is logged in
+	claims := authorization.RequestClaims(r.Context(), session.Manager.GetString(r.Context(), "session_token"))
+	if claims == nil {
+		httperr.Write(w, httperr.New(http.StatusUnauthorized, "Unauthorized", "You are not authorized to access this resource"))
+		return nil, false
+	}
+	return claims, true
+}
@@ -0,0 +1,97 @@
+// Package password checks new passwords against the site's strength policy.
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultMinLength is the minimum length used when a policy doesn't set one.
+const DefaultMinLength = 8
+
+// maxBytes is as much of a password as bcrypt reads. Anything longer would be
+// silently cut off, so it's refused instead.
+const maxBytes = 72
+
+// Policy is the strength a new password must have.
+type Policy struct {
+	// MinLength is the fewest characters a password may have. Zero means
+	// DefaultMinLength.
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// Parse builds a policy from a minimum length and a comma separated list of
+// the character classes a password must contain: upper, lower, digit and
+// symbol.
+func Parse(minLength int, classes string) (Policy, error) {
+	if minLength < 0 {
+		return Policy{}, fmt.Errorf("minimum length can't be negative")
+	}
+	policy := Policy{MinLength: minLength}
+	for _, class := range strings.Split(classes, ",") {
+		switch strings.TrimSpace(strings.ToLower(class)) {
+		case "":
+		case "upper":
+			policy.RequireUpper = true
+		case "lower":
+			policy.RequireLower = true
+		case "digit":
+			policy.RequireDigit = true
+		case "symbol":
+			policy.RequireSymbol = true
+		default:
+			return Policy{}, fmt.Errorf("unknown character class %q", class)
+		}
+	}
+	return policy, nil
+}
+
+// Check returns an error listing every rule the password breaks, or nil.
+func (policy Policy) Check(password string) error {
+	var problems []string
+	minLength := policy.MinLength
+	if minLength == 0 {
+		minLength = DefaultMinLength
+	}
+	if utf8.RuneCountInString(password) < minLength {
+		problems = append(problems, fmt.Sprintf("password must be at least %d characters long", minLength))
+	}
+	if len(password) > maxBytes {
+		problems = append(problems, fmt.Sprintf("password must be at most %d bytes long", maxBytes))
+	}
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if policy.RequireUpper && !upper {
+		problems = append(problems, "password must contain an uppercase letter")
+	}
+	if policy.RequireLower && !lower {
+		problems = append(problems, "password must contain a lowercase letter")
+	}
+	if policy.RequireDigit && !digit {
+		problems = append(problems, "password must contain a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		problems = append(problems, "password must contain a symbol")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	strict := Policy{MinLength: 12, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+	tests := []struct {
+		name     string
+		policy   Policy
+		password string
+		expected string
+	}{
+		{name: "default_length", policy: Policy{}, password: "short", expected: "password must be at least 8 characters long"},
+		{name: "default_ok", policy: Policy{}, password: "longenough"},
+		{name: "counts_characters_not_bytes", policy: Policy{}, password: "pässwörd"},
+		{name: "too_long_for_bcrypt", policy: Policy{}, password: strings.Repeat("a", 73), expected: "password must be at most 72 bytes long"},
+		{name: "strict_ok", policy: strict, password: "Correct-Horse-9"},
+		{name: "strict_lists_every_problem", policy: strict, password: "horse", expected: "password must be at least 12 characters long, password must contain an uppercase letter, password must contain a digit, password must contain a symbol"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.password)
+			if tt.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.expected)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	policy, err := Parse(10, "upper, Digit")
+	assert.NoError(t, err)
+	assert.Equal(t, Policy{MinLength: 10, RequireUpper: true, RequireDigit: true}, policy)
+
+	_, err = Parse(10, "emoji")
+	assert.Error(t, err)
+}
@@ -0,0 +1,157 @@
+// Package rbac maps user roles to the permissions they grant. The built-in
+// roles are defined here; admins can add custom roles, which are stored in the
+// roles table and loaded with SetCustomRoles.
+package rbac
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Role is the role stored on a user and carried in their session token.
+type Role int
+
+const (
+	RoleUser       Role = 0
+	RoleAdmin      Role = 1
+	RolePrivileged Role = 2
+	// FirstCustomRole is the lowest id a custom role may use.
+	FirstCustomRole Role = 3
+)
+
+// Permission is an action a role may be allowed to take. Permissions ending
+// in :any apply to content owned by other users; owners may always act on
+// their own content.
+type Permission string
+
+const (
+	PostCreate             Permission = "post:create"
+	PostUpdateAny          Permission = "post:update:any"
+	PostDeleteAny          Permission = "post:delete:any"
+	PostReadRestricted     Permission = "post:read:restricted"
+	PostReadUnpublishedAny Permission = "post:read:unpublished:any"
+	MediaUpload            Permission = "media:upload"
+	MediaKeepMetadata      Permission = "media:keep-metadata"
+	MediaManage            Permission = "media:manage"
+	CommentModerate        Permission = "comment:moderate"
+	UserManage             Permission = "user:manage"
+	UserAssignRole         Permission = "user:assign-role"
+	RoleManage             Permission = "role:manage"
+)
+
+// Permissions lists every permission, for validating custom roles.
+var Permissions = []Permission{
+	PostCreate, PostUpdateAny, PostDeleteAny, PostReadRestricted, PostReadUnpublishedAny,
+	MediaUpload, MediaKeepMetadata, MediaManage,
+	CommentModerate,
+	UserManage, UserAssignRole,
+	RoleManage,
+}
+
+// Definition describes a role and what it may do.
+type Definition struct {
+	Id          Role         `json:"id"`
+	Name        string       `json:"name"`
+	Permissions []Permission `json:"permissions"`
+	Builtin     bool         `json:"builtin"`
+}
+
+var builtinRoles = []Definition{
+	{Id: RoleUser, Name: "user", Builtin: true, Permissions: []Permission{PostCreate, MediaUpload}},
+	{Id: RoleAdmin, Name: "admin", Builtin: true, Permissions: Permissions},
+	{Id: RolePrivileged, Name: "privileged", Builtin: true, Permissions: []Permission{PostCreate, MediaUpload, PostReadRestricted}},
+}
+
+// role is a definition with its permissions indexed for lookups.
+type role struct {
+	definition  Definition
+	permissions map[Permission]bool
+}
+
+var (
+	mu    sync.RWMutex
+	roles = index(nil)
+)
+
+// Can reports whether role grants perm. Unknown roles grant nothing.
+func Can(id Role, perm Permission) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return roles[id].permissions[perm]
+}
+
+// Exists reports whether id is a built-in or loaded custom role.
+func Exists(id Role) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := roles[id]
+	return ok
+}
+
+// Roles returns the built-in and custom roles, ordered by id.
+func Roles() []Definition {
+	mu.RLock()
+	defer mu.RUnlock()
+	definitions := make([]Definition, 0, len(roles))
+	for _, r := range roles {
+		definitions = append(definitions, r.definition)
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Id < definitions[j].Id })
+	return definitions
+}
+
+// SetCustomRoles replaces the custom roles. Call it at start up and whenever
+// the roles table changes. Definitions that would replace a built-in role are
+// ignored.
+func SetCustomRoles(custom []Definition) {
+	updated := index(custom)
+	mu.Lock()
+	defer mu.Unlock()
+	roles = updated
+}
+
+// Validate checks a custom role before it is stored.
+func Validate(definition Definition) error {
+	if definition.Id < FirstCustomRole {
+		return fmt.Errorf("custom roles must have an id of %d or more", FirstCustomRole)
+	}
+	if definition.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	for _, builtin := range builtinRoles {
+		if definition.Name == builtin.Name {
+			return fmt.Errorf("%q is the name of a built-in role", definition.Name)
+		}
+	}
+	for _, perm := range definition.Permissions {
+		if !slices.Contains(Permissions, perm) {
+			return fmt.Errorf("unknown permission %q", perm)
+		}
+	}
+	return nil
+}
+
+func index(custom []Definition) map[Role]role {
+	indexed := map[Role]role{}
+	for _, definition := range builtinRoles {
+		indexed[definition.Id] = newRole(definition)
+	}
+	for _, definition := range custom {
+		if definition.Id < FirstCustomRole {
+			continue
+		}
+		definition.Builtin = false
+		indexed[definition.Id] = newRole(definition)
+	}
+	return indexed
+}
+
+func newRole(definition Definition) role {
+	permissions := map[Permission]bool{}
+	for _, perm := range definition.Permissions {
+		permissions[perm] = true
+	}
+	return role{definition: definition, permissions: permissions}
+}
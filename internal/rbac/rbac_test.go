@@ -0,0 +1,61 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	SetCustomRoles([]Definition{
+		{Id: 3, Name: "moderator", Permissions: []Permission{CommentModerate}},
+		{Id: RoleUser, Name: "everyone", Permissions: Permissions},
+	})
+	defer SetCustomRoles(nil)
+
+	tests := []struct {
+		name     string
+		role     Role
+		perm     Permission
+		expected bool
+	}{
+		{name: "user_creates_posts", role: RoleUser, perm: PostCreate, expected: true},
+		{name: "user_cannot_manage_users", role: RoleUser, perm: UserManage},
+		{name: "admin_manages_roles", role: RoleAdmin, perm: RoleManage, expected: true},
+		{name: "privileged_reads_restricted", role: RolePrivileged, perm: PostReadRestricted, expected: true},
+		{name: "privileged_cannot_moderate", role: RolePrivileged, perm: CommentModerate},
+		{name: "custom_role", role: 3, perm: CommentModerate, expected: true},
+		{name: "custom_role_only_listed", role: 3, perm: PostCreate},
+		{name: "unknown_role", role: 9, perm: PostCreate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Can(tt.role, tt.perm))
+		})
+	}
+	assert.Len(t, Roles(), 4, "built-in roles can't be replaced")
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition Definition
+		valid      bool
+	}{
+		{name: "valid", definition: Definition{Id: 3, Name: "editor", Permissions: []Permission{PostUpdateAny}}, valid: true},
+		{name: "builtin_id", definition: Definition{Id: RoleAdmin, Name: "admin"}},
+		{name: "builtin_name", definition: Definition{Id: 4, Name: "admin"}},
+		{name: "missing_name", definition: Definition{Id: 4}},
+		{name: "unknown_permission", definition: Definition{Id: 4, Name: "editor", Permissions: []Permission{"post:publish"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.definition)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
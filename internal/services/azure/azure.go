@@ -3,62 +3,62 @@ package azure
 import (
 	"context"
 	"fmt"
-	"mime/multipart"
+	"io"
 	"os"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
 	"github.com/KylerJacobson/Go-Blog-API/logger"
 )
 
+// AzureClient stores media in the "media" container of an Azure storage account.
 type AzureClient struct {
-	logger logger.Logger
+	container *container.Client
+	logger    logger.Logger
 }
 
-func NewAzureClient(logger logger.Logger) *AzureClient {
-	return &AzureClient{
-		logger: logger,
-	}
-}
-
-func (c *AzureClient) UploadFileToBlob(fileHeader *multipart.FileHeader, blobName string) error {
+// NewAzureClient connects using AZURE_STORAGE_CONNECTION_STRING. The client is
+// safe for concurrent use and shared by every request.
+func NewAzureClient(logger logger.Logger) (*AzureClient, error) {
 	connectionString := os.Getenv("AZURE_STORAGE_CONNECTION_STRING")
 	client, err := azblob.NewClientFromConnectionString(connectionString, nil)
 	if err != nil {
-		c.logger.Sugar().Errorf("error creating the client from the connection string: %v", err)
+		logger.Sugar().Errorf("error creating the client from the connection string: %v", err)
+		return nil, err
 	}
-	containerClient := client.ServiceClient().NewContainerClient("media")
-
-	file, err := fileHeader.Open()
-	if err != nil {
-		return fmt.Errorf("error opening file: %v", err)
-	}
-	defer file.Close()
+	return &AzureClient{
+		container: client.ServiceClient().NewContainerClient("media"),
+		logger:    logger,
+	}, nil
+}
 
-	blobClient := containerClient.NewBlockBlobClient(blobName)
+func (c *AzureClient) Upload(ctx context.Context, blobName string, r io.Reader, contentType string) error {
+	blobClient := c.container.NewBlockBlobClient(blobName)
 
 	c.logger.Sugar().Infof("Uploading a blob named %s\n", blobName)
-	_, err = blobClient.UploadStream(context.Background(), file, nil)
+	_, err := blobClient.UploadStream(ctx, r, &blockblob.UploadStreamOptions{
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &contentType},
+	})
 	if err != nil {
 		return fmt.Errorf("error uploading to blob: %v", err)
 	}
 	return nil
 }
 
-func (c *AzureClient) GetUrlForBlob(blobName string) (string, error) {
-	connectionString := os.Getenv("AZURE_STORAGE_CONNECTION_STRING")
-	client, err := azblob.NewClientFromConnectionString(connectionString, nil)
-	if err != nil {
-		c.logger.Sugar().Errorf("error creating the client from the connection string: %v", err)
-	}
-	containerClient := client.ServiceClient().NewContainerClient("media")
-	blobClient := containerClient.NewBlockBlobClient(blobName)
-	// *container.GetSASURLOptions
+func (c *AzureClient) SignedURL(ctx context.Context, blobName string, ttl time.Duration) (string, error) {
+	blobClient := c.container.NewBlockBlobClient(blobName)
 	permission := sas.BlobPermissions{Read: true}
-	start := time.Now()
-	expiry := start.AddDate(1, 0, 0)
+	// Short lifetimes make clock skew matter, so the URL is valid from a few
+	// minutes ago.
+	now := time.Now()
+	start := now.Add(-5 * time.Minute)
+	expiry := now.Add(ttl)
 	options := blob.GetSASURLOptions{StartTime: &start}
 	url, err := blobClient.GetSASURL(permission, expiry, &options)
 	if err != nil {
@@ -67,3 +67,83 @@ func (c *AzureClient) GetUrlForBlob(blobName string) (string, error) {
 	}
 	return url, nil
 }
+
+func (c *AzureClient) Delete(ctx context.Context, blobName string) error {
+	_, err := c.container.NewBlobClient(blobName).Delete(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return storage.ErrNotFound
+	}
+	return err
+}
+
+func (c *AzureClient) Stat(ctx context.Context, blobName string) (*storage.BlobInfo, error) {
+	props, err := c.container.NewBlobClient(blobName).GetProperties(ctx, nil)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	info := &storage.BlobInfo{Name: blobName}
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+	if props.ContentType != nil {
+		info.ContentType = *props.ContentType
+	}
+	if props.ETag != nil {
+		info.ETag = string(*props.ETag)
+	}
+	if props.LastModified != nil {
+		info.LastModified = *props.LastModified
+	}
+	return info, nil
+}
+
+func (c *AzureClient) ReadRange(ctx context.Context, blobName string, offset, length int64) (io.ReadCloser, error) {
+	// A zero count asks Azure for everything after offset.
+	count := max(length, 0)
+	resp, err := c.container.NewBlobClient(blobName).DownloadStream(ctx, &blob.DownloadStreamOptions{
+		Range: blob.HTTPRange{Offset: offset, Count: count},
+	})
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.BlobNotFound) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (c *AzureClient) List(ctx context.Context, prefix string) ([]storage.BlobInfo, error) {
+	var blobs []storage.BlobInfo
+	pager := c.container.NewListBlobsFlatPager(&container.ListBlobsFlatOptions{Prefix: &prefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error listing blobs: %v", err)
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+			info := storage.BlobInfo{Name: *item.Name}
+			if props := item.Properties; props != nil {
+				if props.ContentLength != nil {
+					info.Size = *props.ContentLength
+				}
+				if props.ContentType != nil {
+					info.ContentType = *props.ContentType
+				}
+				if props.ETag != nil {
+					info.ETag = string(*props.ETag)
+				}
+				if props.LastModified != nil {
+					info.LastModified = *props.LastModified
+				}
+			}
+			blobs = append(blobs, info)
+		}
+	}
+	return blobs, nil
+}
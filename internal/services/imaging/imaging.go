@@ -0,0 +1,118 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sort"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+const jpegQuality = 85
+
+// Variant is a resized copy of an uploaded image.
+type Variant struct {
+	Width       int
+	Height      int
+	ContentType string
+	Data        []byte
+}
+
+// Supported reports whether variants can be generated for contentType.
+func Supported(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Decode reads an image of one of the Supported content types.
+func Decode(r io.Reader, contentType string) (image.Image, error) {
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.Decode(r)
+	case "image/png":
+		return png.Decode(r)
+	case "image/webp":
+		return webp.Decode(r)
+	}
+	return nil, fmt.Errorf("unsupported image type %s", contentType)
+}
+
+// Variants resizes img to each of widths that is narrower than the image,
+// keeping the aspect ratio. Every width gets a WebP copy, and JPEG and PNG
+// sources also get a copy in their own format for browsers without WebP.
+func Variants(img image.Image, contentType string, widths []int) ([]Variant, error) {
+	widths = append([]int(nil), widths...)
+	sort.Ints(widths)
+
+	bounds := img.Bounds()
+	var variants []Variant
+	for i, width := range widths {
+		if width <= 0 || width >= bounds.Dx() || (i > 0 && width == widths[i-1]) {
+			continue
+		}
+		height := max(1, bounds.Dy()*width/bounds.Dx())
+		resized := Resize(img, width, height)
+
+		formats := []string{"image/webp"}
+		if contentType != "image/webp" {
+			formats = append(formats, contentType)
+		}
+		for _, format := range formats {
+			data, err := Encode(resized, format)
+			if err != nil {
+				return nil, err
+			}
+			variants = append(variants, Variant{Width: width, Height: height, ContentType: format, Data: data})
+		}
+	}
+	return variants, nil
+}
+
+// Resize scales img to exactly width by height.
+func Resize(img image.Image, width, height int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// Encode writes img in the format named by contentType.
+func Encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	case "image/webp":
+		err = nativewebp.Encode(&buf, img, nil)
+	default:
+		err = fmt.Errorf("unsupported image type %s", contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Extension returns the file extension used for contentType.
+func Extension(contentType string) string {
+	switch contentType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	return img
+}
+
+func TestVariants(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		widths      []int
+		expected    []Variant
+	}{
+		{
+			name:        "jpeg gets webp and jpeg copies",
+			contentType: "image/jpeg",
+			widths:      []int{100, 50},
+			expected: []Variant{
+				{Width: 50, Height: 25, ContentType: "image/webp"},
+				{Width: 50, Height: 25, ContentType: "image/jpeg"},
+				{Width: 100, Height: 50, ContentType: "image/webp"},
+				{Width: 100, Height: 50, ContentType: "image/jpeg"},
+			},
+		},
+		{
+			name:        "webp only gets webp copies",
+			contentType: "image/webp",
+			widths:      []int{100},
+			expected:    []Variant{{Width: 100, Height: 50, ContentType: "image/webp"}},
+		},
+		{
+			name:        "widths at or above the original are skipped",
+			contentType: "image/png",
+			widths:      []int{200, 400, 100, 100},
+			expected: []Variant{
+				{Width: 100, Height: 50, ContentType: "image/webp"},
+				{Width: 100, Height: 50, ContentType: "image/png"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variants, err := Variants(testImage(200, 100), tt.contentType, tt.widths)
+			assert.NoError(t, err)
+			assert.Len(t, variants, len(tt.expected))
+			for i, variant := range variants {
+				assert.Equal(t, tt.expected[i].Width, variant.Width)
+				assert.Equal(t, tt.expected[i].Height, variant.Height)
+				assert.Equal(t, tt.expected[i].ContentType, variant.ContentType)
+
+				decoded, err := Decode(bytes.NewReader(variant.Data), variant.ContentType)
+				assert.NoError(t, err)
+				assert.Equal(t, image.Rect(0, 0, variant.Width, variant.Height), decoded.Bounds())
+			}
+		})
+	}
+}
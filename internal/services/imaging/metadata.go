@@ -0,0 +1,306 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+)
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	exifHeader   = []byte("Exif\x00\x00")
+)
+
+// errMalformed is returned when an image's container can't be walked. The
+// upload is rejected rather than stored with its metadata intact.
+var errMalformed = errors.New("malformed image")
+
+// StripMetadata removes EXIF, XMP, IPTC and text metadata, including GPS
+// coordinates and camera details, from a JPEG, PNG or WebP image. An image
+// with a non-default EXIF orientation is rotated to match and re-encoded, so it
+// still displays upright once the orientation tag is gone. Other content types
+// are returned unchanged.
+func StripMetadata(data []byte, contentType string) ([]byte, error) {
+	var exif []byte
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		exif, err = jpegExif(data)
+	case "image/png":
+		exif, err = pngExif(data)
+	case "image/webp":
+		exif, err = webpExif(data)
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if orientation := exifOrientation(exif); orientation > 1 && orientation <= 8 {
+		img, err := Decode(bytes.NewReader(data), contentType)
+		if err != nil {
+			return nil, err
+		}
+		return Encode(Orient(img, orientation), contentType)
+	}
+
+	switch contentType {
+	case "image/jpeg":
+		return stripJpeg(data)
+	case "image/png":
+		return stripPng(data)
+	default:
+		return stripWebp(data)
+	}
+}
+
+// Orientation returns the EXIF orientation of a JPEG, PNG or WebP image, or 0
+// when it has none.
+func Orientation(data []byte, contentType string) int {
+	var exif []byte
+	switch contentType {
+	case "image/jpeg":
+		exif, _ = jpegExif(data)
+	case "image/png":
+		exif, _ = pngExif(data)
+	case "image/webp":
+		exif, _ = webpExif(data)
+	}
+	return exifOrientation(exif)
+}
+
+// Orient transforms img as described by an EXIF orientation value so that it
+// displays upright.
+func Orient(img image.Image, orientation int) image.Image {
+	src := image.NewRGBA(image.Rect(0, 0, img.Bounds().Dx(), img.Bounds().Dy()))
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// exifOrientation reads the orientation tag from IFD0 of a TIFF structured
+// EXIF payload. It returns 0 when there is no usable tag.
+func exifOrientation(exif []byte) int {
+	exif = bytes.TrimPrefix(exif, exifHeader)
+	if len(exif) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(exif[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int(order.Uint32(exif[4:8]))
+	if offset < 8 || offset+2 > len(exif) {
+		return 0
+	}
+	count := int(order.Uint16(exif[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(exif) {
+			return 0
+		}
+		if order.Uint16(exif[entry:]) == 0x0112 {
+			return int(order.Uint16(exif[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// walkJpeg calls fn with the marker and full bytes of each segment before the
+// start of scan, then returns the remainder of the file.
+func walkJpeg(data []byte, fn func(marker byte, segment []byte)) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errMalformed
+	}
+	pos := 2
+	for {
+		// Markers may be preceded by any number of 0xFF fill bytes.
+		for pos+1 < len(data) && data[pos] == 0xFF && data[pos+1] == 0xFF {
+			pos++
+		}
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, errMalformed
+		}
+		marker := data[pos+1]
+		if marker == 0xDA {
+			return data[pos:], nil
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:]))
+		if end > len(data) {
+			return nil, errMalformed
+		}
+		fn(marker, data[pos:end])
+		pos = end
+	}
+}
+
+func jpegExif(data []byte) ([]byte, error) {
+	var exif []byte
+	_, err := walkJpeg(data, func(marker byte, segment []byte) {
+		if marker == 0xE1 && exif == nil && bytes.HasPrefix(segment[4:], exifHeader) {
+			exif = segment[4:]
+		}
+	})
+	return exif, err
+}
+
+// stripJpeg drops the APP1 (EXIF, XMP), APP3 to APP13 (IPTC and vendor data),
+// APP15 and comment segments. JFIF (APP0), the ICC profile (APP2) and Adobe
+// colour information (APP14) are needed to display the image and are kept.
+func stripJpeg(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	rest, err := walkJpeg(data, func(marker byte, segment []byte) {
+		switch {
+		case marker == 0xE1, marker >= 0xE3 && marker <= 0xED, marker == 0xEF, marker == 0xFE:
+			return
+		}
+		out.Write(segment)
+	})
+	if err != nil {
+		return nil, err
+	}
+	out.Write(rest)
+	return out.Bytes(), nil
+}
+
+// walkPng calls fn with the type and full bytes of each chunk.
+func walkPng(data []byte, fn func(chunkType string, chunk []byte)) error {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return errMalformed
+	}
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return errMalformed
+		}
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:]))
+		if end > len(data) || end < pos {
+			return errMalformed
+		}
+		fn(string(data[pos+4:pos+8]), data[pos:end])
+		pos = end
+	}
+	return nil
+}
+
+func pngExif(data []byte) ([]byte, error) {
+	var exif []byte
+	err := walkPng(data, func(chunkType string, chunk []byte) {
+		if chunkType == "eXIf" {
+			exif = chunk[8 : len(chunk)-4]
+		}
+	})
+	return exif, err
+}
+
+func stripPng(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	err := walkPng(data, func(chunkType string, chunk []byte) {
+		switch chunkType {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+			return
+		}
+		out.Write(chunk)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// walkWebp calls fn with the FourCC and full bytes, including padding, of each
+// RIFF chunk.
+func walkWebp(data []byte, fn func(fourCC string, chunk []byte)) error {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return errMalformed
+	}
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return errMalformed
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2
+		if end > len(data) || end < pos {
+			return errMalformed
+		}
+		fn(string(data[pos:pos+4]), data[pos:end])
+		pos = end
+	}
+	return nil
+}
+
+func webpExif(data []byte) ([]byte, error) {
+	var exif []byte
+	err := walkWebp(data, func(fourCC string, chunk []byte) {
+		if fourCC == "EXIF" {
+			exif = chunk[8 : 8+binary.LittleEndian.Uint32(chunk[4:])]
+		}
+	})
+	return exif, err
+}
+
+// stripWebp drops the EXIF and XMP chunks and clears their flags in the VP8X
+// header.
+func stripWebp(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	err := walkWebp(data, func(fourCC string, chunk []byte) {
+		switch fourCC {
+		case "EXIF", "XMP ":
+			return
+		case "VP8X":
+			if len(chunk) > 8 {
+				chunk = append([]byte(nil), chunk...)
+				chunk[8] &^= 0x08 | 0x04
+			}
+		}
+		out.Write(chunk)
+	})
+	if err != nil {
+		return nil, err
+	}
+	b := out.Bytes()
+	binary.LittleEndian.PutUint32(b[4:], uint32(len(b)-8))
+	return b, nil
+}
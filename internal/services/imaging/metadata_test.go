@@ -0,0 +1,149 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/stretchr/testify/assert"
+)
+
+// exifWithOrientation builds a little-endian TIFF payload whose IFD0 holds the
+// orientation tag and a GPS IFD pointer.
+func exifWithOrientation(orientation uint16) []byte {
+	b := []byte("II*\x00\x08\x00\x00\x00\x02\x00")
+	entry := func(tag, typ uint16, value uint32) {
+		b = binary.LittleEndian.AppendUint16(b, tag)
+		b = binary.LittleEndian.AppendUint16(b, typ)
+		b = binary.LittleEndian.AppendUint32(b, 1)
+		b = binary.LittleEndian.AppendUint32(b, value)
+	}
+	entry(0x0112, 3, uint32(orientation))
+	entry(0x8825, 4, 0)
+	return binary.LittleEndian.AppendUint32(b, 0)
+}
+
+// cornerImage is 32x16 and blue with a red 8x8 top-left corner, so orientation
+// can be checked after lossy encoding.
+func cornerImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 16))
+	for x := 0; x < 32; x++ {
+		for y := 0; y < 16; y++ {
+			if x < 8 && y < 8 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func jpegWithExif(t *testing.T, exif []byte) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, cornerImage(), &jpeg.Options{Quality: 100}))
+	payload := append(append([]byte(nil), exifHeader...), exif...)
+	segment := append([]byte{0xFF, 0xE1}, binary.BigEndian.AppendUint16(nil, uint16(len(payload)+2))...)
+	comment := []byte("\xFF\xFE\x00\x07Canon")
+	data := buf.Bytes()
+	return append(append(append(append([]byte(nil), data[:2]...), segment...), append(payload, comment...)...), data[2:]...)
+}
+
+func pngChunk(chunkType string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	b = append(append(b, chunkType...), data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[4:]))
+}
+
+func pngWithMetadata(t *testing.T, exif []byte) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, cornerImage()))
+	data := buf.Bytes()
+	// Insert after the IHDR chunk, which is always 25 bytes long.
+	ihdrEnd := len(pngSignature) + 25
+	extra := append(pngChunk("tEXt", []byte("Author\x00Someone")), pngChunk("eXIf", exif)...)
+	return append(append(append([]byte(nil), data[:ihdrEnd]...), extra...), data[ihdrEnd:]...)
+}
+
+func webpChunk(fourCC string, data []byte) []byte {
+	b := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	b = append(b, data...)
+	if len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// webpWithExif wraps a simple WebP in the extended format with an EXIF chunk.
+func webpWithExif(t *testing.T, exif []byte) []byte {
+	var buf bytes.Buffer
+	assert.NoError(t, nativewebp.Encode(&buf, cornerImage(), nil))
+	simple := buf.Bytes()[12:]
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x08
+	vp8x[4] = 32 - 1
+	vp8x[7] = 16 - 1
+	body := append(append([]byte("WEBP"), webpChunk("VP8X", vp8x)...), simple...)
+	body = append(body, webpChunk("EXIF", exif)...)
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+func TestStripMetadata(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		build       func(*testing.T, []byte) []byte
+		orientation uint16
+		bounds      image.Rectangle
+		redAt       image.Point
+	}{
+		{name: "jpeg", contentType: "image/jpeg", build: jpegWithExif, orientation: 1, bounds: image.Rect(0, 0, 32, 16), redAt: image.Pt(2, 2)},
+		{name: "rotated jpeg", contentType: "image/jpeg", build: jpegWithExif, orientation: 6, bounds: image.Rect(0, 0, 16, 32), redAt: image.Pt(13, 2)},
+		{name: "png", contentType: "image/png", build: pngWithMetadata, orientation: 1, bounds: image.Rect(0, 0, 32, 16), redAt: image.Pt(2, 2)},
+		{name: "flipped png", contentType: "image/png", build: pngWithMetadata, orientation: 3, bounds: image.Rect(0, 0, 32, 16), redAt: image.Pt(29, 13)},
+		{name: "webp", contentType: "image/webp", build: webpWithExif, orientation: 1, bounds: image.Rect(0, 0, 32, 16), redAt: image.Pt(2, 2)},
+		{name: "rotated webp", contentType: "image/webp", build: webpWithExif, orientation: 8, bounds: image.Rect(0, 0, 16, 32), redAt: image.Pt(2, 29)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.build(t, exifWithOrientation(tt.orientation))
+			stripped, err := StripMetadata(original, tt.contentType)
+			assert.NoError(t, err)
+
+			assert.False(t, bytes.Contains(stripped, []byte("II*\x00")), "EXIF payload left in image")
+			assert.False(t, bytes.Contains(stripped, []byte("Canon")), "comment left in image")
+			assert.False(t, bytes.Contains(stripped, []byte("Someone")), "text chunk left in image")
+
+			img, err := Decode(bytes.NewReader(stripped), tt.contentType)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.bounds, img.Bounds())
+			r, g, b, _ := img.At(tt.redAt.X, tt.redAt.Y).RGBA()
+			assert.Greater(t, r, b, "red corner is not at %v", tt.redAt)
+			assert.Less(t, g, r)
+		})
+	}
+}
+
+func TestStripWebpClearsFlags(t *testing.T) {
+	stripped, err := StripMetadata(webpWithExif(t, exifWithOrientation(1)), "image/webp")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(len(stripped)-8), binary.LittleEndian.Uint32(stripped[4:]))
+	assert.Equal(t, "VP8X", string(stripped[12:16]))
+	assert.Zero(t, stripped[20]&0x08)
+}
+
+func TestStripMetadataRejectsMalformed(t *testing.T) {
+	_, err := StripMetadata([]byte("\xFF\xD8\xFF\xE1\xFF\xFF"), "image/jpeg")
+	assert.Error(t, err)
+
+	data, err := StripMetadata([]byte("plain text"), "text/plain")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("plain text"), data)
+}
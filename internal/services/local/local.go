@@ -0,0 +1,248 @@
+package local
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+)
+
+// metaSuffix marks the sidecar file holding a blob's content type.
+const metaSuffix = ".meta.json"
+
+// LocalStore keeps media on the local disk and serves it through signed,
+// expiring URLs under /media/. It lets the server run without cloud storage.
+type LocalStore struct {
+	root       string
+	baseURL    string
+	signingKey []byte
+	logger     logger.Logger
+}
+
+type blobMeta struct {
+	ContentType string `json:"content_type"`
+}
+
+// NewLocalStore stores blobs below root. Signed URLs start with baseURL, the
+// public address of this server, and are signed with signingKey.
+func NewLocalStore(root, baseURL string, signingKey []byte, logger logger.Logger) (*LocalStore, error) {
+	if len(signingKey) == 0 {
+		return nil, errors.New("local media storage needs a signing key")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating media directory: %v", err)
+	}
+	return &LocalStore{
+		root:       root,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		signingKey: signingKey,
+		logger:     logger,
+	}, nil
+}
+
+func (s *LocalStore) Upload(ctx context.Context, name string, r io.Reader, contentType string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so readers never see a partial blob.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing blob %s: %v", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	meta, _ := json.Marshal(blobMeta{ContentType: contentType})
+	if err := os.WriteFile(p+metaSuffix, meta, 0o644); err != nil {
+		return err
+	}
+	s.logger.Sugar().Infof("Stored a blob named %s", name)
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalStore) SignedURL(ctx context.Context, name string, ttl time.Duration) (string, error) {
+	if _, err := s.path(name); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{"expires": {expires}, "sig": {s.sign(name, expires)}}
+	return s.baseURL + "/media/" + escapePath(name) + "?" + query.Encode(), nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, name string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return storage.ErrNotFound
+		}
+		return err
+	}
+	os.Remove(p + metaSuffix)
+	return nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, name string) (*storage.BlobInfo, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	info := &storage.BlobInfo{
+		Name:         name,
+		Size:         fi.Size(),
+		LastModified: fi.ModTime(),
+		ETag:         fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()),
+	}
+	if b, err := os.ReadFile(p + metaSuffix); err == nil {
+		var meta blobMeta
+		if json.Unmarshal(b, &meta) == nil {
+			info.ContentType = meta.ContentType
+		}
+	}
+	return info, nil
+}
+
+func (s *LocalStore) ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (s *LocalStore) List(ctx context.Context, prefix string) ([]storage.BlobInfo, error) {
+	var blobs []storage.BlobInfo
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(p, metaSuffix) || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		info, err := s.Stat(ctx, name)
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, *info)
+		return nil
+	})
+	return blobs, err
+}
+
+// ServeHTTP serves GET /media/{name...} for URLs issued by SignedURL. Missing,
+// forged and expired signatures are all answered with 403.
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	expires := r.URL.Query().Get("expires")
+	if !s.validSignature(name, expires, r.URL.Query().Get("sig")) {
+		http.Error(w, "invalid or expired media URL", http.StatusForbidden)
+		return
+	}
+	info, err := s.Stat(r.Context(), name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	p, _ := s.path(name)
+	f, err := os.Open(p)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	w.Header().Set("ETag", info.ETag)
+	http.ServeContent(w, r, path.Base(name), info.LastModified, f)
+}
+
+func (s *LocalStore) validSignature(name, expires, sig string) bool {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(s.sign(name, expires)))
+}
+
+func (s *LocalStore) sign(name, expires string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(name + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path maps a blob name to a file below the root, rejecting names that would
+// escape it or clash with the metadata sidecars.
+func (s *LocalStore) path(name string) (string, error) {
+	if name == "" || !fs.ValidPath(name) || strings.HasSuffix(name, metaSuffix) {
+		return "", fmt.Errorf("invalid blob name %q", name)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(name)), nil
+}
+
+func escapePath(name string) string {
+	segments := strings.Split(name, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,85 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func newTestStore(t *testing.T) *LocalStore {
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8080", []byte("secret"), zap.NewNop())
+	assert.NoError(t, err)
+	return store
+}
+
+// serve routes a signed URL through a mux the way main registers the store.
+func serve(store *LocalStore, signedURL string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.Handle("GET /media/{name...}", store)
+	u, _ := url.Parse(signedURL)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+	return rr
+}
+
+func TestLocalStoreLifecycle(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	err := store.Upload(ctx, "blog-media/photo.png", strings.NewReader("png bytes"), "image/png")
+	assert.NoError(t, err)
+
+	info, err := store.Stat(ctx, "blog-media/photo.png")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(9), info.Size)
+	assert.Equal(t, "image/png", info.ContentType)
+
+	signed, err := store.SignedURL(ctx, "blog-media/photo.png", time.Minute)
+	assert.NoError(t, err)
+	rr := serve(store, signed)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "png bytes", rr.Body.String())
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+
+	assert.NoError(t, store.Upload(ctx, "other/file.txt", strings.NewReader("x"), "text/plain"))
+	blobs, err := store.List(ctx, "blog-media/")
+	assert.NoError(t, err)
+	assert.Len(t, blobs, 1)
+	assert.Equal(t, "blog-media/photo.png", blobs[0].Name)
+
+	assert.NoError(t, store.Delete(ctx, "blog-media/photo.png"))
+	_, err = store.Stat(ctx, "blog-media/photo.png")
+	assert.True(t, errors.Is(err, storage.ErrNotFound))
+	assert.True(t, errors.Is(store.Delete(ctx, "blog-media/photo.png"), storage.ErrNotFound))
+}
+
+func TestLocalStoreRejectsBadSignatures(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	assert.NoError(t, store.Upload(ctx, "a.txt", strings.NewReader("a"), "text/plain"))
+
+	expired, err := store.SignedURL(ctx, "a.txt", -time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, serve(store, expired).Code)
+
+	valid, err := store.SignedURL(ctx, "a.txt", time.Minute)
+	assert.NoError(t, err)
+	forged := strings.Replace(valid, "a.txt", "b.txt", 1)
+	assert.Equal(t, http.StatusForbidden, serve(store, forged).Code)
+}
+
+func TestLocalStoreRejectsEscapingNames(t *testing.T) {
+	store := newTestStore(t)
+	for _, name := range []string{"../etc/passwd", "/abs", "a/../../b", "x" + metaSuffix} {
+		assert.Error(t, store.Upload(context.Background(), name, strings.NewReader(""), ""), name)
+	}
+}
@@ -0,0 +1,91 @@
+package markdown
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"regexp"
+	"sync"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Renderer turns post Markdown (CommonMark with GFM tables, fenced code and
+// footnotes) into sanitized HTML. Rendered output is kept in an LRU cache keyed
+// by the hash of the source, so unchanged posts are only rendered once.
+type Renderer struct {
+	md     goldmark.Markdown
+	policy *bluemonday.Policy
+
+	mu       sync.Mutex
+	capacity int
+	entries  map[[sha256.Size]byte]*list.Element
+	order    *list.List
+}
+
+type cacheEntry struct {
+	key  [sha256.Size]byte
+	html string
+}
+
+func NewRenderer(cacheSize int) *Renderer {
+	policy := bluemonday.UGCPolicy()
+	// Keep the language hint of fenced code blocks for client side highlighting.
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	// Footnote links, back references and the footnote list.
+	policy.AllowAttrs("id").Matching(regexp.MustCompile(`^fn(ref)?:[\w-]+$`)).OnElements("li", "sup")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^footnote(s|-ref|-backref)$`)).OnElements("a", "div")
+	policy.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-(noteref|backlink|endnotes)$`)).OnElements("a", "div")
+
+	return &Renderer{
+		md:       goldmark.New(goldmark.WithExtensions(extension.GFM, extension.Footnote)),
+		policy:   policy,
+		capacity: cacheSize,
+		entries:  make(map[[sha256.Size]byte]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Render returns the sanitized HTML for a Markdown source.
+func (r *Renderer) Render(source string) (string, error) {
+	key := sha256.Sum256([]byte(source))
+	if html, ok := r.cached(key); ok {
+		return html, nil
+	}
+
+	var buf bytes.Buffer
+	if err := r.md.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	html := r.policy.SanitizeReader(&buf).String()
+	r.store(key, html)
+	return html, nil
+}
+
+func (r *Renderer) cached(key [sha256.Size]byte) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	element, ok := r.entries[key]
+	if !ok {
+		return "", false
+	}
+	r.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).html, true
+}
+
+func (r *Renderer) store(key [sha256.Size]byte, html string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if element, ok := r.entries[key]; ok {
+		r.order.MoveToFront(element)
+		return
+	}
+	r.entries[key] = r.order.PushFront(&cacheEntry{key: key, html: html})
+	if r.order.Len() > r.capacity {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
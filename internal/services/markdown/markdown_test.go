@@ -0,0 +1,65 @@
+package markdown
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "commonmark",
+			source:   "# Title\n\nSome *emphasis* and a [link](https://example.com).",
+			contains: []string{"<h1>Title</h1>", "<em>emphasis</em>", `href="https://example.com"`},
+		},
+		{
+			name:     "table",
+			source:   "| a | b |\n|---|---|\n| 1 | 2 |",
+			contains: []string{"<table>", "<th>a</th>", "<td>2</td>"},
+		},
+		{
+			name:     "fenced_code",
+			source:   "```go\nfmt.Println(\"hi\")\n```",
+			contains: []string{`<code class="language-go">`},
+		},
+		{
+			name:     "footnote",
+			source:   "A claim.[^1]\n\n[^1]: The source.",
+			contains: []string{`id="fnref:1"`, `href="#fn:1"`, `id="fn:1"`, "The source."},
+		},
+		{
+			name:     "sanitized",
+			source:   "<script>alert(1)</script>\n\n<a href=\"javascript:alert(1)\" onclick=\"x()\">click</a>",
+			excludes: []string{"<script", "javascript:", "onclick"},
+		},
+	}
+	renderer := NewRenderer(10)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := renderer.Render(tt.source)
+			assert.NoError(t, err)
+			for _, s := range tt.contains {
+				assert.Contains(t, html, s)
+			}
+			for _, s := range tt.excludes {
+				assert.NotContains(t, html, s)
+			}
+		})
+	}
+}
+
+func TestRenderCacheEvictsOldest(t *testing.T) {
+	renderer := NewRenderer(2)
+	for _, source := range []string{"a", "b", "c"} {
+		_, err := renderer.Render(source)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, renderer.order.Len())
+	assert.Len(t, renderer.entries, 2)
+}
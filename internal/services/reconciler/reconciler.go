@@ -0,0 +1,154 @@
+package reconciler
+
+import (
+	"context"
+	"time"
+
+	media_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/media"
+	uploads_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/uploads"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+)
+
+const (
+	// mediaPrefix is where uploaded media and its variants are stored.
+	mediaPrefix = "blog-media/"
+	// uploadsPrefix is where the chunks of resumable uploads are stored, under
+	// one directory per upload.
+	uploadsPrefix = "uploads/"
+)
+
+// Reconciler periodically brings the media tables and blob storage back in
+// line: media of deleted posts is removed, and blobs nothing refers to are
+// deleted from storage. Resumable uploads left untouched for longer than the
+// grace period are abandoned and deleted along with their chunks.
+type Reconciler struct {
+	mediaRepository   media_repo.MediaRepository
+	uploadsRepository uploads_repo.UploadsRepository
+	blobStore         storage.BlobStore
+	logger            logger.Logger
+	interval          time.Duration
+	// gracePeriod protects blobs that were just uploaded and whose media row
+	// hasn't been written yet. Blob reservations older than this are abandoned.
+	gracePeriod time.Duration
+}
+
+func NewReconciler(mediaRepo media_repo.MediaRepository, uploadsRepo uploads_repo.UploadsRepository, blobStore storage.BlobStore, logger logger.Logger, interval, gracePeriod time.Duration) *Reconciler {
+	return &Reconciler{
+		mediaRepository:   mediaRepo,
+		uploadsRepository: uploadsRepo,
+		blobStore:         blobStore,
+		logger:            logger,
+		interval:          interval,
+		gracePeriod:       gracePeriod,
+	}
+}
+
+// Run reconciles every interval until ctx is cancelled.
+func (rc *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(rc.interval)
+	defer ticker.Stop()
+	for {
+		rc.Reconcile(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile runs a single pass. Failures are logged and retried on the next pass.
+func (rc *Reconciler) Reconcile(ctx context.Context) {
+	deleted, err := rc.mediaRepository.DeleteMediaWithoutPost()
+	if err != nil {
+		rc.logger.Sugar().Errorf("error deleting media of deleted posts: %v", err)
+		return
+	}
+	if deleted > 0 {
+		rc.logger.Sugar().Infof("deleted %d media rows of deleted posts", deleted)
+	}
+
+	released, err := rc.mediaRepository.ReleaseUnreferencedBlobs(time.Now().Add(-rc.gracePeriod))
+	if err != nil {
+		rc.logger.Sugar().Errorf("error releasing unreferenced blobs: %v", err)
+		return
+	}
+	if err := storage.DeleteAll(ctx, rc.blobStore, released); err != nil {
+		rc.logger.Sugar().Errorf("error deleting unreferenced blobs: %v", err)
+	}
+	if len(released) > 0 {
+		rc.logger.Sugar().Infof("deleted %d unreferenced blobs", len(released))
+	}
+
+	rc.deleteStrayBlobs(ctx)
+	rc.deleteStaleUploads(ctx)
+}
+
+// deleteStaleUploads removes resumable uploads that were finished or
+// abandoned more than gracePeriod ago, together with any chunks left behind.
+func (rc *Reconciler) deleteStaleUploads(ctx context.Context) {
+	stale, err := rc.uploadsRepository.GetStaleUploads(time.Now().Add(-rc.gracePeriod))
+	if err != nil {
+		rc.logger.Sugar().Errorf("error getting stale uploads: %v", err)
+		return
+	}
+	for _, upload := range stale {
+		chunks, err := rc.blobStore.List(ctx, uploadsPrefix+upload.UploadId+"/")
+		if err != nil {
+			rc.logger.Sugar().Errorf("error listing chunks of upload %s: %v", upload.UploadId, err)
+			continue
+		}
+		names := make([]string, len(chunks))
+		for i, chunk := range chunks {
+			names[i] = chunk.Name
+		}
+		if err := storage.DeleteAll(ctx, rc.blobStore, names); err != nil {
+			rc.logger.Sugar().Errorf("error deleting chunks of upload %s: %v", upload.UploadId, err)
+			continue
+		}
+		if err := rc.uploadsRepository.DeleteUpload(upload.UploadId); err != nil {
+			rc.logger.Sugar().Errorf("error deleting upload %s: %v", upload.UploadId, err)
+		}
+	}
+	if len(stale) > 0 {
+		rc.logger.Sugar().Infof("deleted %d stale uploads", len(stale))
+	}
+}
+
+// deleteStrayBlobs removes blobs in storage that no media row, blob record or
+// variant refers to, such as uploads that failed before being recorded.
+func (rc *Reconciler) deleteStrayBlobs(ctx context.Context) {
+	blobs, err := rc.blobStore.List(ctx, mediaPrefix)
+	if err != nil {
+		rc.logger.Sugar().Errorf("error listing media blobs: %v", err)
+		return
+	}
+	cutoff := time.Now().Add(-rc.gracePeriod)
+	var candidates []string
+	for _, blob := range blobs {
+		if blob.LastModified.Before(cutoff) {
+			candidates = append(candidates, blob.Name)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+	known, err := rc.mediaRepository.KnownBlobs(candidates)
+	if err != nil {
+		rc.logger.Sugar().Errorf("error checking media blobs: %v", err)
+		return
+	}
+	var stray []string
+	for _, name := range candidates {
+		if !known[name] {
+			stray = append(stray, name)
+		}
+	}
+	if err := storage.DeleteAll(ctx, rc.blobStore, stray); err != nil {
+		rc.logger.Sugar().Errorf("error deleting stray blobs: %v", err)
+	}
+	if len(stray) > 0 {
+		rc.logger.Sugar().Infof("deleted %d stray blobs", len(stray))
+	}
+}
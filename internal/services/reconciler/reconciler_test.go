@@ -0,0 +1,123 @@
+package reconciler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	media_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/media"
+	upload_models "github.com/KylerJacobson/Go-Blog-API/internal/api/types/uploads"
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/local"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type fakeMediaRepository struct {
+	known    map[string]bool
+	released []string
+}
+
+func (f *fakeMediaRepository) GetMediaByPostId(postId int) ([]media_models.Post, error) {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) ReserveBlob(blobName string) (bool, error) {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) ReleaseBlob(blobName string) error {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) UploadMedia(media media_models.NewMedia) (int, error) {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) DeleteMedia(mediaId int) (*media_models.Post, []string, error) {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) GetMediaById(mediaId int) (*media_models.Post, error) {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) ListMedia(query media_models.MediaQuery) ([]media_models.Post, error) {
+	panic("implement me")
+}
+
+func (f *fakeMediaRepository) DeleteMediaWithoutPost() (int64, error) {
+	return 0, nil
+}
+
+func (f *fakeMediaRepository) ReleaseUnreferencedBlobs(staleBefore time.Time) ([]string, error) {
+	return f.released, nil
+}
+
+func (f *fakeMediaRepository) KnownBlobs(blobNames []string) (map[string]bool, error) {
+	return f.known, nil
+}
+
+type fakeUploadsRepository struct {
+	stale   []upload_models.Upload
+	deleted []string
+}
+
+func (f *fakeUploadsRepository) CreateUpload(upload upload_models.Upload) error {
+	panic("implement me")
+}
+
+func (f *fakeUploadsRepository) GetUpload(uploadId string) (*upload_models.Upload, error) {
+	panic("implement me")
+}
+
+func (f *fakeUploadsRepository) AdvanceOffset(uploadId string, from, to int64) (bool, error) {
+	panic("implement me")
+}
+
+func (f *fakeUploadsRepository) CompleteUpload(uploadId string, mediaId int) error {
+	panic("implement me")
+}
+
+func (f *fakeUploadsRepository) DeleteUpload(uploadId string) error {
+	f.deleted = append(f.deleted, uploadId)
+	return nil
+}
+
+func (f *fakeUploadsRepository) GetStaleUploads(updatedBefore time.Time) ([]upload_models.Upload, error) {
+	return f.stale, nil
+}
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := local.NewLocalStore(root, "http://localhost", []byte("key"), zap.NewNop())
+	assert.NoError(t, err)
+
+	names := []string{"blog-media/known", "blog-media/released", "blog-media/stray", "blog-media/fresh-stray", "uploads/other", "uploads/stale/00000000000000000000", "uploads/stale/00000000000000000100"}
+	for _, name := range names {
+		assert.NoError(t, store.Upload(ctx, name, strings.NewReader(name), "text/plain"))
+		if name != "blog-media/fresh-stray" {
+			old := time.Now().Add(-48 * time.Hour)
+			assert.NoError(t, os.Chtimes(filepath.Join(root, name), old, old))
+		}
+	}
+
+	repo := &fakeMediaRepository{
+		known:    map[string]bool{"blog-media/known": true},
+		released: []string{"blog-media/released", "blog-media/already-gone"},
+	}
+	uploads := &fakeUploadsRepository{stale: []upload_models.Upload{{UploadId: "stale"}}}
+	NewReconciler(repo, uploads, store, zap.NewNop(), time.Hour, 24*time.Hour).Reconcile(ctx)
+
+	remaining, err := store.List(ctx, "")
+	assert.NoError(t, err)
+	var remainingNames []string
+	for _, blob := range remaining {
+		remainingNames = append(remainingNames, blob.Name)
+	}
+	assert.ElementsMatch(t, []string{"blog-media/known", "blog-media/fresh-stray", "uploads/other"}, remainingNames)
+	assert.Equal(t, []string{"stale"}, uploads.deleted)
+}
@@ -0,0 +1,171 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// maxPresignTTL is the longest lifetime SigV4 allows for a presigned URL.
+const maxPresignTTL = 7 * 24 * time.Hour
+
+// Config points the client at an S3-compatible service such as AWS S3 or MinIO.
+type Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	// URLTTL caps the lifetime of presigned GET URLs. It defaults to, and can't
+	// exceed, the seven days S3 allows.
+	URLTTL time.Duration
+}
+
+// S3Client stores media in a bucket of an S3-compatible object store.
+type S3Client struct {
+	client *minio.Client
+	bucket string
+	urlTTL time.Duration
+	logger logger.Logger
+}
+
+func NewS3Client(cfg Config, logger logger.Logger) (*S3Client, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating the s3 client: %v", err)
+	}
+	urlTTL := cfg.URLTTL
+	if urlTTL <= 0 || urlTTL > maxPresignTTL {
+		urlTTL = maxPresignTTL
+	}
+	return &S3Client{
+		client: client,
+		bucket: cfg.Bucket,
+		urlTTL: urlTTL,
+		logger: logger,
+	}, nil
+}
+
+// uploadPartSize is the part size used when the size of an upload isn't
+// known. Without it the client sizes parts for the largest object S3 allows
+// and allocates over 500 MiB per upload.
+const uploadPartSize = 16 << 20
+
+// Upload streams r to the bucket. When storage.SizeOf knows the size of r it
+// is sent up front; otherwise the client sends a multipart upload in parts of
+// uploadPartSize, without buffering the whole file.
+func (c *S3Client) Upload(ctx context.Context, name string, r io.Reader, contentType string) error {
+	_, err := c.client.PutObject(ctx, c.bucket, name, r, storage.SizeOf(r), minio.PutObjectOptions{ContentType: contentType, PartSize: uploadPartSize})
+	if err != nil {
+		c.logger.Sugar().Errorf("error uploading %s to bucket %s: %v", name, c.bucket, err)
+		return err
+	}
+	c.logger.Sugar().Infof("Uploaded an object named %s", name)
+	return nil
+}
+
+// MaxURLTTL is the longest lifetime SignedURL signs URLs for.
+func (c *S3Client) MaxURLTTL() time.Duration {
+	return c.urlTTL
+}
+
+func (c *S3Client) SignedURL(ctx context.Context, name string, ttl time.Duration) (string, error) {
+	if ttl > c.urlTTL {
+		ttl = c.urlTTL
+	}
+	u, err := c.client.PresignedGetObject(ctx, c.bucket, name, ttl, nil)
+	if err != nil {
+		c.logger.Sugar().Errorf("error presigning %s: %v", name, err)
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (c *S3Client) Delete(ctx context.Context, name string) error {
+	// S3 deletes succeed for missing keys, so check first to report ErrNotFound
+	// like the other stores.
+	if _, err := c.Stat(ctx, name); err != nil {
+		return err
+	}
+	return c.client.RemoveObject(ctx, c.bucket, name, minio.RemoveObjectOptions{})
+}
+
+func (c *S3Client) Stat(ctx context.Context, name string) (*storage.BlobInfo, error) {
+	info, err := c.client.StatObject(ctx, c.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return &storage.BlobInfo{
+		Name:         name,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (c *S3Client) ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	if offset > 0 || length >= 0 {
+		end := int64(0)
+		if length >= 0 {
+			end = offset + length - 1
+		}
+		if err := opts.SetRange(offset, end); err != nil {
+			return nil, err
+		}
+	}
+	object, err := c.client.GetObject(ctx, c.bucket, name, opts)
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy, so a missing key only shows up on the first read.
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		if isNotFound(err) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return object, nil
+}
+
+func (c *S3Client) List(ctx context.Context, prefix string) ([]storage.BlobInfo, error) {
+	var blobs []storage.BlobInfo
+	for object := range c.client.ListObjects(ctx, c.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		blobs = append(blobs, storage.BlobInfo{
+			Name:         object.Key,
+			Size:         object.Size,
+			ContentType:  object.ContentType,
+			ETag:         object.ETag,
+			LastModified: object.LastModified,
+		})
+	}
+	return blobs, nil
+}
+
+func isNotFound(err error) bool {
+	var resp minio.ErrorResponse
+	if !errors.As(err, &resp) {
+		return false
+	}
+	return resp.Code == "NoSuchKey" || resp.Code == "NotFound"
+}
@@ -0,0 +1,69 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KylerJacobson/Go-Blog-API/internal/services/storage"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// TestS3ClientAgainstMinio runs against a real MinIO server, e.g.
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	MINIO_ENDPOINT=localhost:9000 go test ./internal/services/s3/
+func TestS3ClientAgainstMinio(t *testing.T) {
+	endpoint := os.Getenv("MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("MINIO_ENDPOINT is not set")
+	}
+	ctx := context.Background()
+	client, err := NewS3Client(Config{
+		Endpoint:  endpoint,
+		Bucket:    "go-blog-api-test",
+		AccessKey: envOr("MINIO_ACCESS_KEY", "minioadmin"),
+		SecretKey: envOr("MINIO_SECRET_KEY", "minioadmin"),
+		URLTTL:    time.Minute,
+	}, zap.NewNop())
+	assert.NoError(t, err)
+	exists, err := client.client.BucketExists(ctx, client.bucket)
+	assert.NoError(t, err)
+	if !exists {
+		assert.NoError(t, client.client.MakeBucket(ctx, client.bucket, minio.MakeBucketOptions{}))
+	}
+
+	name := "blog-media/test-" + time.Now().Format("150405.000")
+	assert.NoError(t, client.Upload(ctx, name, strings.NewReader("hello"), "text/plain"))
+
+	info, err := client.Stat(ctx, name)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), info.Size)
+	assert.Equal(t, "text/plain", info.ContentType)
+
+	url, err := client.SignedURL(ctx, name, time.Hour)
+	assert.NoError(t, err)
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "hello", string(body))
+
+	assert.NoError(t, client.Delete(ctx, name))
+	_, err = client.Stat(ctx, name)
+	assert.True(t, errors.Is(err, storage.ErrNotFound))
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	posts_repo "github.com/KylerJacobson/Go-Blog-API/internal/db/posts"
+	"github.com/KylerJacobson/Go-Blog-API/logger"
+)
+
+// Publisher periodically publishes scheduled posts whose publish_at has passed.
+type Publisher struct {
+	postsRepository posts_repo.PostsRepository
+	logger          logger.Logger
+	interval        time.Duration
+}
+
+func NewPublisher(postsRepo posts_repo.PostsRepository, logger logger.Logger, interval time.Duration) *Publisher {
+	return &Publisher{
+		postsRepository: postsRepo,
+		logger:          logger,
+		interval:        interval,
+	}
+}
+
+// Run publishes due posts every interval until ctx is cancelled.
+func (p *Publisher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		p.publishDuePosts()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Publisher) publishDuePosts() {
+	published, err := p.postsRepository.PublishScheduledPosts()
+	if err != nil {
+		p.logger.Sugar().Errorf("error publishing scheduled posts: %v", err)
+		return
+	}
+	if published > 0 {
+		p.logger.Sugar().Infof("published %d scheduled posts", published)
+	}
+}
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxCachedURLs bounds the cache. Expired entries are swept when it fills up.
+const maxCachedURLs = 10000
+
+type urlKey struct {
+	name string
+	ttl  time.Duration
+}
+
+type cachedURL struct {
+	url     string
+	expires time.Time
+}
+
+// CachedURLs wraps a BlobStore so that SignedURL reuses a previously signed URL
+// while at least half of its lifetime remains. Callers always get a URL that
+// stays valid for at least ttl/2, and pages that list the same media don't
+// sign it again on every request.
+type CachedURLs struct {
+	BlobStore
+
+	mu   sync.Mutex
+	urls map[urlKey]cachedURL
+	now  func() time.Time
+}
+
+func NewCachedURLs(store BlobStore) *CachedURLs {
+	return &CachedURLs{
+		BlobStore: store,
+		urls:      map[urlKey]cachedURL{},
+		now:       time.Now,
+	}
+}
+
+func (c *CachedURLs) SignedURL(ctx context.Context, name string, ttl time.Duration) (string, error) {
+	// Cache with the lifetime the store will actually sign for, so a URL is
+	// never handed out after it has expired.
+	if limiter, ok := c.BlobStore.(URLLifetimeLimiter); ok {
+		ttl = min(ttl, limiter.MaxURLTTL())
+	}
+	key := urlKey{name: name, ttl: ttl}
+	now := c.now()
+
+	c.mu.Lock()
+	cached, ok := c.urls[key]
+	c.mu.Unlock()
+	if ok && cached.expires.Sub(now) > ttl/2 {
+		return cached.url, nil
+	}
+
+	url, err := c.BlobStore.SignedURL(ctx, name, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.urls) >= maxCachedURLs {
+		c.sweep(now)
+	}
+	c.urls[key] = cachedURL{url: url, expires: now.Add(ttl)}
+	return url, nil
+}
+
+// Delete also forgets the blob's cached URLs.
+func (c *CachedURLs) Delete(ctx context.Context, name string) error {
+	c.mu.Lock()
+	for key := range c.urls {
+		if key.name == name {
+			delete(c.urls, key)
+		}
+	}
+	c.mu.Unlock()
+	return c.BlobStore.Delete(ctx, name)
+}
+
+// sweep drops entries that would no longer be handed out. If everything is
+// still fresh the cache is cleared rather than allowed to grow. c.mu must be held.
+func (c *CachedURLs) sweep(now time.Time) {
+	for key, cached := range c.urls {
+		if cached.expires.Sub(now) <= key.ttl/2 {
+			delete(c.urls, key)
+		}
+	}
+	if len(c.urls) >= maxCachedURLs {
+		c.urls = map[urlKey]cachedURL{}
+	}
+}
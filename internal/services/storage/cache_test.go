@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore signs URLs that record how many times it was asked.
+type countingStore struct {
+	signed int
+}
+
+func (s *countingStore) Upload(ctx context.Context, name string, r io.Reader, contentType string) error {
+	return nil
+}
+
+func (s *countingStore) SignedURL(ctx context.Context, name string, ttl time.Duration) (string, error) {
+	s.signed++
+	return fmt.Sprintf("https://example.com/%s?n=%d", name, s.signed), nil
+}
+
+func (s *countingStore) Delete(ctx context.Context, name string) error {
+	return nil
+}
+
+func (s *countingStore) Stat(ctx context.Context, name string) (*BlobInfo, error) {
+	return nil, ErrNotFound
+}
+
+func (s *countingStore) ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	return nil, ErrNotFound
+}
+
+func (s *countingStore) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	return nil, nil
+}
+
+func TestCachedURLs(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{}
+	cache := NewCachedURLs(store)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	first, _ := cache.SignedURL(ctx, "a", time.Hour)
+	again, _ := cache.SignedURL(ctx, "a", time.Hour)
+	assert.Equal(t, first, again, "reused while fresh")
+
+	other, _ := cache.SignedURL(ctx, "a", time.Minute)
+	assert.NotEqual(t, first, other, "cached per ttl")
+
+	now = now.Add(29 * time.Minute)
+	stillFresh, _ := cache.SignedURL(ctx, "a", time.Hour)
+	assert.Equal(t, first, stillFresh)
+
+	now = now.Add(2 * time.Minute)
+	refreshed, _ := cache.SignedURL(ctx, "a", time.Hour)
+	assert.NotEqual(t, first, refreshed, "refreshed once half the lifetime is used")
+
+	assert.NoError(t, cache.Delete(ctx, "a"))
+	afterDelete, _ := cache.SignedURL(ctx, "a", time.Hour)
+	assert.NotEqual(t, refreshed, afterDelete, "forgotten on delete")
+	assert.Equal(t, 4, store.signed)
+}
+
+// cappedStore signs URLs for at most max.
+type cappedStore struct {
+	countingStore
+	max time.Duration
+}
+
+func (s *cappedStore) MaxURLTTL() time.Duration {
+	return s.max
+}
+
+func TestCachedURLsCappedStore(t *testing.T) {
+	ctx := context.Background()
+	store := &cappedStore{max: 10 * time.Minute}
+	cache := NewCachedURLs(store)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	first, _ := cache.SignedURL(ctx, "a", time.Hour)
+	now = now.Add(6 * time.Minute)
+	again, _ := cache.SignedURL(ctx, "a", time.Hour)
+	assert.NotEqual(t, first, again, "refreshed by the store's lifetime, not the requested one")
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// BlobReader is an io.ReadSeekCloser over a stored blob, suitable for
+// http.ServeContent. Seeking is free; each read after a seek opens a ranged
+// read at the new offset, so serving a Range request only downloads the
+// requested bytes.
+type BlobReader struct {
+	ctx    context.Context
+	store  BlobStore
+	name   string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewBlobReader reads the named blob, whose size must already be known from Stat.
+func NewBlobReader(ctx context.Context, store BlobStore, name string, size int64) *BlobReader {
+	return &BlobReader{ctx: ctx, store: store, name: name, size: size}
+}
+
+func (r *BlobReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.store.ReadRange(r.ctx, r.name, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *BlobReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *BlobReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// ConcatReader reads several blobs one after another as a single stream,
+// opening each only when the previous one is exhausted.
+type ConcatReader struct {
+	ctx     context.Context
+	store   BlobStore
+	names   []string
+	current io.ReadCloser
+}
+
+func NewConcatReader(ctx context.Context, store BlobStore, names []string) *ConcatReader {
+	return &ConcatReader{ctx: ctx, store: store, names: names}
+}
+
+func (r *ConcatReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.names) == 0 {
+				return 0, io.EOF
+			}
+			body, err := r.store.ReadRange(r.ctx, r.names[0], 0, -1)
+			if err != nil {
+				return 0, err
+			}
+			r.current, r.names = body, r.names[1:]
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *ConcatReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// rangeStore serves ReadRange from a string and records the ranges requested.
+type rangeStore struct {
+	countingStore
+	content string
+	ranges  []int64
+}
+
+func (s *rangeStore) ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	s.ranges = append(s.ranges, offset)
+	return io.NopCloser(strings.NewReader(s.content[offset:])), nil
+}
+
+func TestBlobReader(t *testing.T) {
+	store := &rangeStore{content: "0123456789"}
+	r := NewBlobReader(context.Background(), store, "blob", 10)
+
+	end, err := r.Seek(0, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), end)
+	_, err = r.Seek(0, io.SeekStart)
+	assert.NoError(t, err)
+	assert.Empty(t, store.ranges, "seeking alone doesn't read")
+
+	buf := make([]byte, 3)
+	_, err = io.ReadFull(r, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "012", string(buf))
+
+	_, err = r.Seek(4, io.SeekCurrent)
+	assert.NoError(t, err)
+	rest, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "789", string(rest))
+	assert.Equal(t, []int64{0, 7}, store.ranges)
+
+	_, err = r.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+	assert.NoError(t, r.Close())
+}
+
+// chunkStore serves each blob name as its own content.
+type chunkStore struct {
+	countingStore
+}
+
+func (s *chunkStore) ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(name)), nil
+}
+
+func TestConcatReader(t *testing.T) {
+	r := NewConcatReader(context.Background(), &chunkStore{}, []string{"ab", "", "cde", "f"})
+	content, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdef", string(content))
+	assert.NoError(t, r.Close())
+}
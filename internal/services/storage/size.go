@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"io"
+	"os"
+)
+
+// sizedReader is a reader whose remaining length is known.
+type sizedReader struct {
+	io.Reader
+	size int64
+}
+
+// WithSize records that r holds size bytes, so a BlobStore that benefits from
+// knowing the size up front doesn't have to guess it.
+func WithSize(r io.Reader, size int64) io.Reader {
+	return sizedReader{Reader: r, size: size}
+}
+
+// SizeOf returns the number of bytes left in r: the size given to WithSize,
+// the length of an in-memory reader or what's left of a regular file. It
+// returns -1 when that can't be told without reading r.
+func SizeOf(r io.Reader) int64 {
+	switch v := r.(type) {
+	case sizedReader:
+		return v.size
+	case interface{ Len() int }:
+		// bytes.Buffer, bytes.Reader and strings.Reader
+		return int64(v.Len())
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - offset
+	}
+	return -1
+}
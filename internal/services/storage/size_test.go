@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizeOf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blob")
+	assert.NoError(t, os.WriteFile(path, []byte("0123456789"), 0o600))
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	_, err = file.Seek(4, io.SeekStart)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(5), SizeOf(bytes.NewReader([]byte("hello"))))
+	assert.Equal(t, int64(6), SizeOf(file), "what's left of the file")
+	assert.Equal(t, int64(3), SizeOf(WithSize(io.NopCloser(strings.NewReader("abc")), 3)))
+	assert.Equal(t, int64(-1), SizeOf(io.MultiReader(strings.NewReader("abc"))))
+}
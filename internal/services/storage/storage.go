@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned by a BlobStore when the named blob doesn't exist.
+var ErrNotFound = errors.New("blob not found")
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	Name         string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// URLLifetimeLimiter is implemented by a BlobStore that signs URLs for no
+// longer than MaxURLTTL, whatever ttl SignedURL is asked for.
+type URLLifetimeLimiter interface {
+	MaxURLTTL() time.Duration
+}
+
+// BlobStore is where uploaded media lives. Blob names are slash separated
+// paths such as "blog-media/photo.png".
+type BlobStore interface {
+	// Upload stores the content of r under name, replacing any existing blob.
+	Upload(ctx context.Context, name string, r io.Reader, contentType string) error
+	// SignedURL returns a URL that grants read access to the blob until ttl elapses.
+	SignedURL(ctx context.Context, name string, ttl time.Duration) (string, error)
+	Delete(ctx context.Context, name string) error
+	Stat(ctx context.Context, name string) (*BlobInfo, error)
+	// ReadRange streams length bytes of the blob starting at offset. A length
+	// of -1 reads to the end.
+	ReadRange(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+	// List returns every blob whose name starts with prefix.
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+}
+
+// DeleteAll deletes every named blob, ignoring ones that are already gone.
+func DeleteAll(ctx context.Context, store BlobStore, names []string) error {
+	var errs []error
+	for _, name := range names {
+		if err := store.Delete(ctx, name); err != nil && !errors.Is(err, ErrNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
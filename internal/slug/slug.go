@@ -0,0 +1,55 @@
+package slug
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const maxLength = 80
+
+// reserved slugs collide with sub-resource routes under /api/posts/{id}/.
+var reserved = map[string]bool{
+	"revisions": true,
+	"comments":  true,
+}
+
+// Make turns a title into a URL friendly slug: lowercase letters and digits
+// separated by single hyphens. Titles without any letters or digits become "post".
+func Make(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+			continue
+		}
+		hyphen = true
+	}
+	s := b.String()
+	if len(s) > maxLength {
+		s = strings.TrimRight(truncate(s, maxLength), "-")
+	}
+	if s == "" {
+		return "post"
+	}
+	return s
+}
+
+// IsReserved reports whether a slug can't be used because it names a route.
+func IsReserved(s string) bool {
+	return reserved[s]
+}
+
+// truncate cuts s to at most n bytes without splitting a multi-byte rune.
+func truncate(s string, n int) string {
+	for len(s) > n {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return s
+}
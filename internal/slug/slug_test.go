@@ -0,0 +1,33 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		title    string
+		expected string
+	}{
+		{title: "Hello, World!", expected: "hello-world"},
+		{title: "  Go 1.22 routing -- the new ServeMux  ", expected: "go-1-22-routing-the-new-servemux"},
+		{title: "Crème brûlée", expected: "crème-brûlée"},
+		{title: "!!!", expected: "post"},
+		{title: "", expected: "post"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Make(tt.title))
+		})
+	}
+}
+
+func TestMakeTruncates(t *testing.T) {
+	s := Make(strings.Repeat("é", 100))
+	assert.LessOrEqual(t, len(s), maxLength)
+	assert.True(t, strings.HasPrefix(s, "é"))
+	assert.False(t, strings.HasSuffix(Make(strings.Repeat("ab ", 40)), "-"))
+}
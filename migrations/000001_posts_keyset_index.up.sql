@@ -0,0 +1,2 @@
+-- Supports keyset pagination of posts ordered by (created_at, post_id).
+CREATE INDEX IF NOT EXISTS posts_created_at_post_id_idx ON posts (created_at DESC, post_id DESC);
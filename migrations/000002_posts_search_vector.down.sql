@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS posts_search_vector_idx;
+ALTER TABLE posts DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,13 @@
+CREATE TABLE tags (
+    tag_id     SERIAL PRIMARY KEY,
+    name       TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE post_tags (
+    post_id INT NOT NULL REFERENCES posts (post_id) ON DELETE CASCADE,
+    tag_id  INT NOT NULL REFERENCES tags (tag_id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, tag_id)
+);
+
+CREATE INDEX post_tags_tag_id_idx ON post_tags (tag_id);
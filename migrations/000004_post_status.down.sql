@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS posts_scheduled_publish_at_idx;
+ALTER TABLE posts DROP COLUMN IF EXISTS publish_at, DROP COLUMN IF EXISTS status;
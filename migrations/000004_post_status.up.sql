@@ -0,0 +1,8 @@
+ALTER TABLE posts
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'published'
+        CHECK (status IN ('draft', 'scheduled', 'published', 'archived')),
+    ADD COLUMN publish_at TIMESTAMPTZ;
+
+UPDATE posts SET publish_at = created_at;
+
+CREATE INDEX posts_scheduled_publish_at_idx ON posts (publish_at) WHERE status = 'scheduled';
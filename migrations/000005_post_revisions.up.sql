@@ -0,0 +1,15 @@
+CREATE TABLE post_revisions (
+    revision_id SERIAL PRIMARY KEY,
+    post_id     INT NOT NULL REFERENCES posts (post_id) ON DELETE CASCADE,
+    revision    INT NOT NULL,
+    title       TEXT NOT NULL,
+    content     TEXT NOT NULL,
+    restricted  BOOLEAN NOT NULL,
+    edited_by   INT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (post_id, revision)
+);
+
+-- Existing posts start their history with their current content.
+INSERT INTO post_revisions (post_id, revision, title, content, restricted, edited_by, created_at)
+SELECT post_id, 1, title, content, restricted, user_id, updated_at FROM posts;
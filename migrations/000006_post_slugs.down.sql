@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS post_slug_redirects;
+DROP INDEX IF EXISTS posts_slug_idx;
+ALTER TABLE posts DROP COLUMN IF EXISTS slug;
@@ -0,0 +1,17 @@
+ALTER TABLE posts ADD COLUMN slug TEXT;
+
+-- Existing posts get their id appended so backfilled slugs never collide.
+UPDATE posts SET slug = COALESCE(
+    NULLIF(trim(BOTH '-' FROM lower(regexp_replace(title, '[^[:alnum:]]+', '-', 'g'))), ''),
+    'post'
+) || '-' || post_id;
+
+ALTER TABLE posts ALTER COLUMN slug SET NOT NULL;
+CREATE UNIQUE INDEX posts_slug_idx ON posts (slug);
+
+-- Slugs a post used before its title changed, kept so old links keep working.
+CREATE TABLE post_slug_redirects (
+    slug       TEXT PRIMARY KEY,
+    post_id    INT NOT NULL REFERENCES posts (post_id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,14 @@
+CREATE TABLE comments (
+    comment_id   SERIAL PRIMARY KEY,
+    post_id      INT NOT NULL REFERENCES posts (post_id) ON DELETE CASCADE,
+    parent_id    INT REFERENCES comments (comment_id) ON DELETE CASCADE,
+    user_id      INT NOT NULL,
+    content      TEXT NOT NULL,
+    status       TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    moderated_by INT,
+    moderated_at TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX comments_post_id_idx ON comments (post_id, created_at);
+CREATE INDEX comments_pending_idx ON comments (created_at) WHERE status = 'pending';
@@ -0,0 +1 @@
+ALTER TABLE posts DROP COLUMN IF EXISTS last_edited_by;
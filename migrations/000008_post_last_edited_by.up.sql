@@ -0,0 +1,3 @@
+ALTER TABLE posts ADD COLUMN last_edited_by INT;
+
+UPDATE posts SET last_edited_by = user_id;
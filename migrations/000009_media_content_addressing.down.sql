@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS media_blobs;
+
+DROP INDEX IF EXISTS media_post_id_idx;
+DROP INDEX IF EXISTS media_media_id_idx;
+ALTER TABLE media DROP COLUMN IF EXISTS size;
+ALTER TABLE media DROP COLUMN IF EXISTS content_hash;
+ALTER TABLE media DROP COLUMN IF EXISTS original_filename;
+ALTER TABLE media DROP COLUMN IF EXISTS media_id;
@@ -0,0 +1,22 @@
+ALTER TABLE media ADD COLUMN media_id SERIAL;
+CREATE UNIQUE INDEX media_media_id_idx ON media (media_id);
+CREATE INDEX media_post_id_idx ON media (post_id);
+
+ALTER TABLE media ADD COLUMN original_filename TEXT;
+ALTER TABLE media ADD COLUMN content_hash TEXT;
+ALTER TABLE media ADD COLUMN size BIGINT;
+
+-- Blobs uploaded before content addressing were named after the file.
+UPDATE media SET original_filename = regexp_replace(blob_name, '^.*/', '');
+ALTER TABLE media ALTER COLUMN original_filename SET NOT NULL;
+
+-- One row per stored blob. ref_count is the number of media rows using it, so a
+-- blob shared by several posts is only removed once the last one lets go.
+CREATE TABLE media_blobs (
+    blob_name  TEXT PRIMARY KEY,
+    ref_count  INT NOT NULL CHECK (ref_count >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+INSERT INTO media_blobs (blob_name, ref_count)
+SELECT blob_name, count(*) FROM media GROUP BY blob_name;
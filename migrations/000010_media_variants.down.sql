@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS media_variants;
+
+ALTER TABLE media_blobs DROP COLUMN IF EXISTS height;
+ALTER TABLE media_blobs DROP COLUMN IF EXISTS width;
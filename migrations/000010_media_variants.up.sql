@@ -0,0 +1,15 @@
+ALTER TABLE media_blobs ADD COLUMN width INT;
+ALTER TABLE media_blobs ADD COLUMN height INT;
+
+-- Resized copies of an image blob, served as a srcset next to the original.
+CREATE TABLE media_variants (
+    blob_name         TEXT PRIMARY KEY,
+    source_blob_name  TEXT NOT NULL REFERENCES media_blobs (blob_name) ON DELETE CASCADE,
+    width             INT NOT NULL,
+    height            INT NOT NULL,
+    content_type      TEXT NOT NULL,
+    size              BIGINT NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX media_variants_source_idx ON media_variants (source_blob_name);
@@ -0,0 +1,16 @@
+-- Resumable (tus) uploads in progress. The received bytes are kept in blob
+-- storage as chunks under uploads/<upload_id>/ until the upload completes.
+CREATE TABLE uploads (
+    upload_id     TEXT PRIMARY KEY,
+    user_id       INT NOT NULL,
+    post_id       INT NOT NULL,
+    filename      TEXT NOT NULL,
+    restricted    BOOLEAN NOT NULL DEFAULT false,
+    upload_length BIGINT NOT NULL CHECK (upload_length >= 0),
+    upload_offset BIGINT NOT NULL DEFAULT 0 CHECK (upload_offset <= upload_length),
+    media_id      INT,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX uploads_updated_at_idx ON uploads (updated_at);
@@ -0,0 +1,11 @@
+-- Password reset tokens. Only a SHA-256 hash of each token is stored, so a
+-- leaked table can't be used to reset passwords.
+CREATE TABLE password_resets (
+    token_hash TEXT PRIMARY KEY,
+    user_id    INT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX password_resets_user_id_idx ON password_resets (user_id) WHERE used_at IS NULL;
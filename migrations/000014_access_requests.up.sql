@@ -0,0 +1,14 @@
+-- Requests for privileged access made at sign up. The account is created as a
+-- normal user and only gets the requested role once an admin approves.
+CREATE TABLE access_requests (
+    request_id     SERIAL PRIMARY KEY,
+    user_id        INT NOT NULL,
+    requested_role INT NOT NULL,
+    status         TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'denied')),
+    reason         TEXT,
+    decided_by     INT,
+    decided_at     TIMESTAMPTZ,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX access_requests_pending_idx ON access_requests (user_id) WHERE status = 'pending';
@@ -0,0 +1,9 @@
+-- Custom roles defined by admins. The built-in roles, 0 (user), 1 (admin) and
+-- 2 (privileged), are defined in code and can't be changed here.
+CREATE TABLE roles (
+    role_id     INT PRIMARY KEY CHECK (role_id >= 3),
+    name        TEXT NOT NULL UNIQUE,
+    permissions TEXT[] NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
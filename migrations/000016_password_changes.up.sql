@@ -0,0 +1,5 @@
+-- session_version is carried in session tokens. Raising it signs the user out
+-- of every session issued before.
+ALTER TABLE users
+    ADD COLUMN session_version INT NOT NULL DEFAULT 0,
+    ADD COLUMN password_reset_required BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+-- The accounts that had role -1 aren't recorded, so this can't be undone.
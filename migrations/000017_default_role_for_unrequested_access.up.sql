@@ -0,0 +1,3 @@
+-- Sign ups that asked for no access (-1) used to store -1 as their role,
+-- which grants no permissions. They get the default role instead.
+UPDATE users SET role = 0 WHERE role = -1;
@@ -0,0 +1,3 @@
+ALTER TABLE media_blobs
+    DROP COLUMN IF EXISTS reserved_at,
+    DROP COLUMN IF EXISTS reserved;
@@ -0,0 +1,6 @@
+-- reserved counts uploads that are writing or reusing the blob and haven't
+-- recorded their media row yet. A blob is only released once both counts are
+-- zero; reservations older than the reconciler's grace period are abandoned.
+ALTER TABLE media_blobs
+    ADD COLUMN reserved INT NOT NULL DEFAULT 0 CHECK (reserved >= 0),
+    ADD COLUMN reserved_at TIMESTAMPTZ;